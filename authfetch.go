@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AuthorizedFetch configures the signing of the GET requests, which is required by the servers
+// running in "secure mode", like Mastodon instances with AUTHORIZED_FETCH enabled, that respond
+// with 401 Unauthorized to unsigned requests.
+type AuthorizedFetch struct {
+	// SignFn signs the requests, usually as the instance, or application, actor.
+	SignFn RequestSignFn
+	// Always enables signing all GET requests. When false, the requests are sent unsigned first,
+	// and they are retried signed if the remote server responds with 401 Unauthorized.
+	Always bool
+	// Hosts are the hosts for which the GET requests are always signed
+	Hosts []string
+}
+
+// WithAuthorizedFetch enables signing the GET and HEAD requests with af.SignFn, instead of the
+// signing function of the client. The hosts that required signed requests are remembered, and the next
+// requests to them are signed directly.
+func WithAuthorizedFetch(af AuthorizedFetch) OptionFn {
+	return func(c *C) error {
+		if af.SignFn == nil {
+			c.authFetch = nil
+			return nil
+		}
+		c.authFetch = &authorizedFetch{cfg: af, hosts: make(map[string]struct{})}
+		for _, h := range af.Hosts {
+			c.authFetch.remember(h)
+		}
+		return nil
+	}
+}
+
+// SignedFetchHosts returns the hosts for which the client signs the GET requests,
+// both the configured ones, and the ones that responded with 401 Unauthorized to unsigned requests.
+func (c C) SignedFetchHosts() []string {
+	if c.authFetch == nil {
+		return nil
+	}
+	c.authFetch.m.RLock()
+	defer c.authFetch.m.RUnlock()
+	hosts := make([]string, 0, len(c.authFetch.hosts))
+	for h := range c.authFetch.hosts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+type authorizedFetch struct {
+	cfg   AuthorizedFetch
+	m     sync.RWMutex
+	hosts map[string]struct{}
+}
+
+func (a *authorizedFetch) signs(host string) bool {
+	if a.cfg.Always {
+		return true
+	}
+	a.m.RLock()
+	defer a.m.RUnlock()
+	_, ok := a.hosts[strings.ToLower(host)]
+	return ok
+}
+
+func (a *authorizedFetch) remember(host string) {
+	a.m.Lock()
+	defer a.m.Unlock()
+	a.hosts[strings.ToLower(host)] = struct{}{}
+}
+
+func isFetch(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead
+}
+
+// fetchAuthorized executes a GET or HEAD request, signing it if the remote host requires it.
+func (c C) fetchAuthorized(ctx context.Context, u, method string, fns ...reqFn) (*http.Response, error) {
+	host := ""
+	if uu, err := url.Parse(u); err == nil {
+		host = uu.Hostname()
+	}
+	signed := c
+	signed.signFn = c.authFetch.cfg.SignFn
+	if c.authFetch.signs(host) {
+		return signed.doRequest(ctx, u, method, "", nil, fns...)
+	}
+
+	unsigned := c
+	unsigned.signFn = defaultSignFn
+	resp, err := unsigned.doRequest(ctx, u, method, "", nil, fns...)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	c.infoFn(Ctx{"iri": u, "status": resp.Status})("Unsigned request rejected, retrying signed")
+	if resp, err = signed.doRequest(ctx, u, method, "", nil, fns...); err == nil && resp.StatusCode < http.StatusBadRequest {
+		c.authFetch.remember(host)
+	}
+	return resp, err
+}
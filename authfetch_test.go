@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestWithAuthorizedFetch(t *testing.T) {
+	var unsigned, signed int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Signature") == "" {
+			unsigned++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		signed++
+		w.Write([]byte(`{"type": "Note"}`))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	instance := CavageSigner{KeyID: "https://example.com/actor#main-key", Key: testEd25519Key}.Sign
+	c := New(WithAuthorizedFetch(AuthorizedFetch{SignFn: instance}))
+	for i := 0; i < 2; i++ {
+		if it, err := c.CtxLoadIRI(context.Background(), vocab.IRI(srv.URL+"/note")); err != nil || it.GetType() != vocab.NoteType {
+			t.Fatalf("CtxLoadIRI() = %v, %v", it, err)
+		}
+	}
+	if unsigned != 1 || signed != 2 {
+		t.Errorf("Sent %d unsigned and %d signed requests, expected 1 and 2", unsigned, signed)
+	}
+	if hosts := c.SignedFetchHosts(); len(hosts) != 1 || hosts[0] != u.Hostname() {
+		t.Errorf("SignedFetchHosts() = %v, expected the host to be remembered", hosts)
+	}
+
+	unsigned, signed = 0, 0
+	c = New(WithAuthorizedFetch(AuthorizedFetch{SignFn: instance, Hosts: []string{u.Hostname()}}))
+	if _, err := c.CtxLoadIRI(context.Background(), vocab.IRI(srv.URL+"/note")); err != nil {
+		t.Fatalf("CtxLoadIRI() error = %s", err)
+	}
+	if unsigned != 0 || signed != 1 {
+		t.Errorf("Sent %d unsigned and %d signed requests, expected the configured host to be always signed", unsigned, signed)
+	}
+}
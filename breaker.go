@@ -0,0 +1,214 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+// HostState is the state of the circuit breaker for a remote host
+type HostState int
+
+const (
+	// HostUp is the state of hosts that respond normally, requests to them are allowed
+	HostUp HostState = iota
+	// HostDown is the state of hosts that failed too many consecutive requests, requests to them fail fast
+	HostDown
+	// HostProbing is the state of hosts that were down, and are being probed by a single request
+	HostProbing
+)
+
+func (s HostState) String() string {
+	switch s {
+	case HostUp:
+		return "up"
+	case HostDown:
+		return "down"
+	case HostProbing:
+		return "probing"
+	}
+	return "unknown"
+}
+
+// HostHealth holds the health information the circuit breaker keeps for a remote host
+type HostHealth struct {
+	State HostState
+	// Failures is the number of consecutive failed requests
+	Failures int
+	// LastFailure is the time of the last failed request
+	LastFailure time.Time
+	// RetryAt is the time after which a host that is down gets probed again
+	RetryAt time.Time
+}
+
+// CircuitBreaker configures the per host circuit breaker of the client.
+type CircuitBreaker struct {
+	// Threshold is the number of consecutive failures after which a host is considered down
+	Threshold int
+	// Cooldown is the time we wait before probing a host that is down
+	Cooldown time.Duration
+	// MaxCooldown caps the cooldown, which doubles every time a probe fails
+	MaxCooldown time.Duration
+}
+
+// CircuitOpenError is returned for requests that have not been sent because the remote host is considered down
+type CircuitOpenError struct {
+	Host    string
+	RetryAt time.Time
+}
+
+func (e CircuitOpenError) Error() string {
+	return fmt.Sprintf("host %s is down, retrying after %s", e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+// IsCircuitOpen returns true if the err error was caused by a request to a host that is considered down
+func IsCircuitOpen(err error) bool {
+	return errors.As(err, new(CircuitOpenError))
+}
+
+// WithCircuitBreaker enables the per host circuit breaker, which stops sending requests to hosts
+// that have failed cb.Threshold consecutive requests with network errors or server errors.
+func WithCircuitBreaker(cb CircuitBreaker) OptionFn {
+	return func(c *C) error {
+		if cb.Threshold <= 0 {
+			c.breaker = nil
+			return nil
+		}
+		c.breaker = &breaker{cfg: cb, hosts: make(map[string]*hostCircuit)}
+		return nil
+	}
+}
+
+// HostHealth returns the health information for the host.
+// Hosts we don't have any information about are reported as up.
+func (c C) HostHealth(host string) HostHealth {
+	if c.breaker == nil {
+		return HostHealth{}
+	}
+	return c.breaker.health(host)
+}
+
+// UnhealthyHosts returns the health information for all the hosts that are currently not up.
+func (c C) UnhealthyHosts() map[string]HostHealth {
+	res := make(map[string]HostHealth)
+	if c.breaker == nil {
+		return res
+	}
+	c.breaker.m.Lock()
+	defer c.breaker.m.Unlock()
+	for host, hc := range c.breaker.hosts {
+		if hc.State != HostUp {
+			res[host] = hc.HostHealth
+		}
+	}
+	return res
+}
+
+type breaker struct {
+	cfg   CircuitBreaker
+	m     sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+type hostCircuit struct {
+	HostHealth
+	cooldown time.Duration
+}
+
+func (b *breaker) health(host string) HostHealth {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if hc, ok := b.hosts[strings.ToLower(host)]; ok {
+		return hc.HostHealth
+	}
+	return HostHealth{}
+}
+
+// allow checks if a request to host can be sent. When the cooldown of a host that is down has passed,
+// it lets a single request through, to probe if the host has recovered.
+func (b *breaker) allow(host string, now time.Time) error {
+	if b == nil {
+		return nil
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	hc, ok := b.hosts[strings.ToLower(host)]
+	if !ok {
+		return nil
+	}
+	switch hc.State {
+	case HostDown:
+		if now.Before(hc.RetryAt) {
+			return CircuitOpenError{Host: host, RetryAt: hc.RetryAt}
+		}
+		hc.State = HostProbing
+	case HostProbing:
+		return CircuitOpenError{Host: host, RetryAt: hc.RetryAt}
+	}
+	return nil
+}
+
+// abandon is called for requests that have been cancelled by us, which don't say anything about
+// the health of host. If the request was a probe, the next request will be allowed to probe again.
+func (b *breaker) abandon(host string) {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	if hc, ok := b.hosts[strings.ToLower(host)]; ok && hc.State == HostProbing {
+		hc.State = HostDown
+	}
+}
+
+// record updates the state of host with the result of a request.
+func (b *breaker) record(host string, resp *http.Response, err error, now time.Time) {
+	if b == nil {
+		return
+	}
+	host = strings.ToLower(host)
+
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	hc, ok := b.hosts[host]
+	if !isHostFailure(resp, err) {
+		delete(b.hosts, host)
+		return
+	}
+	if !ok {
+		hc = &hostCircuit{cooldown: b.cfg.Cooldown}
+		b.hosts[host] = hc
+	}
+
+	hc.Failures++
+	hc.LastFailure = now
+	switch {
+	case hc.State == HostProbing:
+		hc.cooldown *= 2
+		if b.cfg.MaxCooldown > 0 && hc.cooldown > b.cfg.MaxCooldown {
+			hc.cooldown = b.cfg.MaxCooldown
+		}
+		fallthrough
+	case hc.Failures >= b.cfg.Threshold:
+		hc.State = HostDown
+		hc.RetryAt = now.Add(hc.cooldown)
+	}
+}
+
+func isHostFailure(resp *http.Response, err error) bool {
+	if err != nil {
+		// NOTE(marius): requests refused by us don't say anything about the health of the host
+		return !IsBlockedAddress(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
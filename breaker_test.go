@@ -0,0 +1,76 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestWithCircuitBreaker(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	host := u.Hostname()
+
+	c := New(WithCircuitBreaker(CircuitBreaker{Threshold: 2, Cooldown: 50 * time.Millisecond}))
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %s", err)
+		}
+		resp.Body.Close()
+	}
+	if h := c.HostHealth(host); h.State != HostDown || h.Failures != 2 {
+		t.Errorf("HostHealth() = %+v, expected host to be down after 2 failures", h)
+	}
+	if _, ok := c.UnhealthyHosts()[host]; !ok {
+		t.Errorf("UnhealthyHosts() should contain %s", host)
+	}
+
+	_, err := c.Get(srv.URL)
+	if !IsCircuitOpen(err) {
+		t.Errorf("Get() error = %v, expected a circuit open error", err)
+	}
+	if requests != 2 {
+		t.Errorf("server received %d requests, expected 2", requests)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	status = http.StatusOK
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %s after the cooldown", err)
+	}
+	resp.Body.Close()
+	if h := c.HostHealth(host); h.State != HostUp {
+		t.Errorf("HostHealth() = %+v, expected host to be up after a successful probe", h)
+	}
+}
+
+func Test_breaker_probeFailure(t *testing.T) {
+	b := &breaker{cfg: CircuitBreaker{Threshold: 1, Cooldown: time.Second, MaxCooldown: 3 * time.Second}, hosts: make(map[string]*hostCircuit)}
+	now := time.Now()
+	b.record("example.com", nil, errf("connection refused"), now)
+	if err := b.allow("example.com", now); !IsCircuitOpen(err) {
+		t.Fatalf("allow() = %v, expected a circuit open error", err)
+	}
+
+	now = now.Add(time.Second)
+	if err := b.allow("example.com", now); err != nil {
+		t.Fatalf("allow() = %s, expected the probe to be allowed", err)
+	}
+	if err := b.allow("example.com", now); !IsCircuitOpen(err) {
+		t.Errorf("allow() = %v, expected a single probe to be allowed", err)
+	}
+	b.record("example.com", nil, errf("connection refused"), now)
+	if h := b.health("example.com"); h.State != HostDown || !h.RetryAt.Equal(now.Add(2*time.Second)) {
+		t.Errorf("health() = %+v, expected the cooldown to double after a failed probe", h)
+	}
+}
@@ -0,0 +1,185 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+// Cache is the storage used by the client for keeping the raw documents it loads,
+// together with the HTTP validators needed to revalidate them with the remote servers.
+type Cache interface {
+	// Load returns the entry stored for the iri IRI, if any
+	Load(iri vocab.IRI) (*CacheEntry, bool)
+	// Store saves the e entry for the iri IRI
+	Store(iri vocab.IRI, e *CacheEntry) error
+	// Delete removes the entry stored for the iri IRI
+	Delete(iri vocab.IRI) error
+}
+
+// CacheEntry holds the raw JSON document loaded from a remote server, and the information we need
+// for revalidating it.
+type CacheEntry struct {
+	Body []byte `json:"body"`
+	// URL is the URL the body was loaded from, after following redirects
+	URL          string    `json:"url,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Expires      time.Time `json:"expires"`
+}
+
+// WithCache sets the cache used for storing the documents loaded with C.LoadIRI and C.CtxLoadIRI
+func WithCache(cache Cache) OptionFn {
+	return func(c *C) error {
+		c.cache = cache
+		return nil
+	}
+}
+
+// Fresh returns true if the entry can be used without revalidating it with the remote server
+func (e CacheEntry) Fresh(now time.Time) bool {
+	return now.Before(e.Expires)
+}
+
+func (e CacheEntry) document(id vocab.IRI) document {
+	doc := document{body: e.Body, url: e.URL}
+	if len(doc.url) == 0 {
+		doc.url = id.String()
+	}
+	return doc
+}
+
+func (e CacheEntry) conditional(r *http.Request) {
+	if len(e.ETag) > 0 {
+		r.Header.Set("If-None-Match", e.ETag)
+	}
+	if len(e.LastModified) > 0 {
+		r.Header.Set("If-Modified-Since", e.LastModified)
+	}
+}
+
+// revalidated returns a copy of the entry updated with the validators and expiry
+// received in a "304 Not Modified" response.
+func (e CacheEntry) revalidated(resp *http.Response, now time.Time) *CacheEntry {
+	ee := e
+	if etag := resp.Header.Get("ETag"); len(etag) > 0 {
+		ee.ETag = etag
+	}
+	if lm := resp.Header.Get("Last-Modified"); len(lm) > 0 {
+		ee.LastModified = lm
+	}
+	ee.Expires, _ = expiresFromHeaders(resp.Header, now)
+	return &ee
+}
+
+// newCacheEntry returns a cache entry for the body of the resp response,
+// or nil if the response headers don't allow it to be stored.
+func newCacheEntry(resp *http.Response, doc document, now time.Time) *CacheEntry {
+	expires, ok := expiresFromHeaders(resp.Header, now)
+	if !ok {
+		return nil
+	}
+	e := CacheEntry{
+		Body:         doc.body,
+		URL:          doc.url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Expires:      expires,
+	}
+	if !e.Fresh(now) && len(e.ETag)+len(e.LastModified) == 0 {
+		// NOTE(marius): without validators, an entry that is already stale is useless
+		return nil
+	}
+	return &e
+}
+
+// expiresFromHeaders computes the time until which a response can be considered fresh,
+// based on its Cache-Control, Age and Expires headers.
+// It returns false if the response must not be stored.
+func expiresFromHeaders(h http.Header, now time.Time) (time.Time, bool) {
+	var maxAge time.Duration = -1
+	for _, dir := range strings.Split(h.Get("Cache-Control"), ",") {
+		dir = strings.ToLower(strings.TrimSpace(dir))
+		switch {
+		case dir == "no-store":
+			return now, false
+		case dir == "no-cache":
+			maxAge = 0
+		case strings.HasPrefix(dir, "max-age="):
+			if maxAge == 0 {
+				// NOTE(marius): no-cache takes precedence
+				continue
+			}
+			if sec, err := strconv.ParseInt(strings.TrimPrefix(dir, "max-age="), 10, 64); err == nil {
+				maxAge = time.Duration(sec) * time.Second
+			}
+		}
+	}
+	if maxAge >= 0 {
+		if age, err := strconv.ParseInt(h.Get("Age"), 10, 64); err == nil {
+			maxAge -= time.Duration(age) * time.Second
+		}
+		return now.Add(maxAge), true
+	}
+	if exp := h.Get("Expires"); len(exp) > 0 {
+		if t, err := http.ParseTime(exp); err == nil {
+			return t, true
+		}
+		// NOTE(marius): invalid values, like "0", mean the response is already expired
+	}
+	return now, true
+}
+
+func (c C) storeCache(iri vocab.IRI, e *CacheEntry) {
+	if c.cache == nil {
+		return
+	}
+	if err := c.cache.Store(iri, e); err != nil {
+		c.errFn(Ctx{"IRI": iri})("Unable to store cache entry: %s", err)
+	}
+}
+
+// MemCache is an in-memory Cache implementation.
+type MemCache struct {
+	m sync.RWMutex
+	e map[vocab.IRI]CacheEntry
+}
+
+// NewMemCache creates a new empty in-memory cache
+func NewMemCache() *MemCache {
+	return &MemCache{e: make(map[vocab.IRI]CacheEntry)}
+}
+
+// Load returns the entry stored for the iri IRI, if any
+func (m *MemCache) Load(iri vocab.IRI) (*CacheEntry, bool) {
+	m.m.RLock()
+	defer m.m.RUnlock()
+	e, ok := m.e[iri]
+	if !ok {
+		return nil, false
+	}
+	return &e, true
+}
+
+// Store saves the e entry for the iri IRI
+func (m *MemCache) Store(iri vocab.IRI, e *CacheEntry) error {
+	if e == nil {
+		return nil
+	}
+	m.m.Lock()
+	defer m.m.Unlock()
+	m.e[iri] = *e
+	return nil
+}
+
+// Delete removes the entry stored for the iri IRI
+func (m *MemCache) Delete(iri vocab.IRI) error {
+	m.m.Lock()
+	defer m.m.Unlock()
+	delete(m.e, iri)
+	return nil
+}
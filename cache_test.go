@@ -0,0 +1,124 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestC_LoadIRI_withCache(t *testing.T) {
+	tests := []struct {
+		name         string
+		cacheControl string
+		wantRequests int
+		wantBodies   int
+	}{
+		{
+			name:         "fresh",
+			cacheControl: "max-age=60",
+			wantRequests: 1,
+			wantBodies:   1,
+		},
+		{
+			name:         "revalidate",
+			cacheControl: "max-age=0",
+			wantRequests: 3,
+			wantBodies:   1,
+		},
+		{
+			name:         "no-store",
+			cacheControl: "no-store, max-age=60",
+			wantRequests: 3,
+			wantBodies:   3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, bodies := 0, 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				w.Header().Set("ETag", `"v1"`)
+				if r.Header.Get("If-None-Match") == `"v1"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				bodies++
+				w.Write([]byte(`{"id": "https://example.com/1", "type": "Note"}`))
+			}))
+			defer srv.Close()
+
+			c := New(WithCache(NewMemCache()))
+			for i := 0; i < 3; i++ {
+				it, err := c.LoadIRI(vocab.IRI(srv.URL))
+				if err != nil {
+					t.Fatalf("LoadIRI() error = %s", err)
+				}
+				if it.GetLink() != "https://example.com/1" {
+					t.Errorf("LoadIRI() returned %s", it.GetLink())
+				}
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("server received %d requests, expected %d", requests, tt.wantRequests)
+			}
+			if bodies != tt.wantBodies {
+				t.Errorf("server sent %d bodies, expected %d", bodies, tt.wantBodies)
+			}
+		})
+	}
+}
+
+func Test_expiresFromHeaders(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		header    http.Header
+		want      time.Time
+		wantStore bool
+	}{
+		{
+			name:      "empty",
+			header:    http.Header{},
+			want:      now,
+			wantStore: true,
+		},
+		{
+			name:      "max-age with age",
+			header:    http.Header{"Cache-Control": {"public, max-age=300"}, "Age": {"100"}},
+			want:      now.Add(200 * time.Second),
+			wantStore: true,
+		},
+		{
+			name:      "no-cache wins over max-age",
+			header:    http.Header{"Cache-Control": {"no-cache, max-age=300"}},
+			want:      now,
+			wantStore: true,
+		},
+		{
+			name:      "expires",
+			header:    http.Header{"Expires": {now.Add(time.Hour).Format(http.TimeFormat)}},
+			want:      now.Add(time.Hour),
+			wantStore: true,
+		},
+		{
+			name:      "no-store",
+			header:    http.Header{"Cache-Control": {"no-store"}},
+			want:      now,
+			wantStore: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, store := expiresFromHeaders(tt.header, now)
+			if !got.Equal(tt.want) {
+				t.Errorf("expiresFromHeaders() = %s, expected %s", got, tt.want)
+			}
+			if store != tt.wantStore {
+				t.Errorf("expiresFromHeaders() store = %t, expected %t", store, tt.wantStore)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package client
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"io"
@@ -56,11 +55,25 @@ var (
 )
 
 type C struct {
-	signFn RequestSignFn
-	c      *http.Client
-	l      logger
-	infoFn CtxLogFn
-	errFn  CtxLogFn
+	signFn  RequestSignFn
+	c       *http.Client
+	l       logger
+	infoFn  CtxLogFn
+	errFn   CtxLogFn
+	cache   Cache
+	flight  *flight
+	retry   *RetryPolicy
+	limiter *limiter
+	breaker *breaker
+	domains DomainPolicy
+	knock   *doubleKnock
+	handles *handles
+
+	authFetch    *authorizedFetch
+	verifyOrigin bool
+	quirks       *Quirks
+
+	deliveryWorkers int
 }
 
 // SetDefaultHTTPClient is a hacky solution to modify the default static instance of the http.DefaultClient
@@ -146,24 +159,34 @@ var (
 		Transport: defaultTransport,
 	}
 
-	defaultTransport http.RoundTripper = &http.Transport{
+	defaultTransport http.RoundTripper = newTransport(newDialer())
+)
+
+func newDialer() *net.Dialer {
+	return &net.Dialer{
+		// This is the TCP connect timeout in this instance.
+		Timeout: 2500 * time.Millisecond,
+	}
+}
+
+func newTransport(d *net.Dialer) *http.Transport {
+	return &http.Transport{
 		MaxIdleConns:        100,
 		IdleConnTimeout:     90 * time.Second,
 		MaxIdleConnsPerHost: 20,
-		DialContext: (&net.Dialer{
-			// This is the TCP connect timeout in this instance.
-			Timeout: 2500 * time.Millisecond,
-		}).DialContext,
+		DialContext:         d.DialContext,
 		TLSHandshakeTimeout: 2500 * time.Millisecond,
 	}
-)
+}
 
 func New(o ...OptionFn) *C {
 	c := &C{
-		c:      defaultClient,
-		signFn: defaultSignFn,
-		infoFn: defaultCtxLogger,
-		errFn:  defaultCtxLogger,
+		c:       defaultClient,
+		signFn:  defaultSignFn,
+		infoFn:  defaultCtxLogger,
+		errFn:   defaultCtxLogger,
+		flight:  new(flight),
+		handles: new(handles),
 	}
 	for _, fn := range o {
 		fn(c)
@@ -179,58 +202,167 @@ func (c *C) SignFn(fn RequestSignFn) {
 }
 
 func (c C) loadCtx(ctx context.Context, id vocab.IRI) (vocab.Item, error) {
-	errCtx := Ctx{"IRI": id}
-	st := time.Now()
+	return c.load(ctx, id, 0)
+}
+
+// load dereferences the id IRI, the depth parameter counts the nested loads triggered by the origin verification.
+func (c C) load(ctx context.Context, id vocab.IRI, depth int) (vocab.Item, error) {
 	if len(id) == 0 {
 		return nil, errf("Invalid IRI, nil value").iri(id)
 	}
 	if _, err := url.ParseRequestURI(id.String()); err != nil {
 		return nil, errf("Trying to load an invalid IRI").iri(id).annotate(err)
 	}
-	var err error
-	var obj vocab.Item
+	// NOTE(marius): concurrent loads of the same IRI share the same request, and the IRIs with fragments
+	// share it with the IRI of the document they belong to
+	docIRI := documentIRI(id)
+	doc, err := c.flight.do(ctx, docIRI, c.fetch)
+	if err != nil {
+		if IsGone(err) {
+			return tombstone(docIRI, doc.body), err
+		}
+		return nil, err
+	}
+	if c.quirks != nil {
+		doc.body = c.normalize(ctx, doc)
+	}
+	var it vocab.Item
+	if docIRI != id {
+		it, err = fragmentNode(doc.body, id)
+	} else {
+		it, err = vocab.UnmarshalJSON(doc.body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !vocab.IsNil(it) && it.GetType() == vocab.TombstoneType {
+		// NOTE(marius): some servers respond with a Tombstone and a successful status for deleted objects
+		return it, errors.Gonef("Object has been deleted: %s", id)
+	}
+	if c.verifyOrigin && !vocab.IsNil(it) {
+		return c.verify(ctx, id, doc, it, depth)
+	}
+	return it, nil
+}
+
+// tombstone returns the Tombstone that the server sent for a deleted object,
+// or, if the response body didn't contain one, a Tombstone synthesized from the id IRI.
+func tombstone(id vocab.IRI, body []byte) vocab.Item {
+	if len(body) > 0 {
+		if it, err := vocab.UnmarshalJSON(body); err == nil && !vocab.IsNil(it) && it.GetType() == vocab.TombstoneType {
+			return it
+		}
+	}
+	return &vocab.Tombstone{ID: id, Type: vocab.TombstoneType}
+}
+
+// document is the raw representation of an object, as loaded from the remote server or from the cache
+type document struct {
+	body []byte
+	// url is the URL the document was loaded from, after following redirects
+	url string
+}
 
+// fetch loads the raw representation of the id IRI, either from the cache, if we have a fresh copy,
+// or from the remote server.
+func (c C) fetch(ctx context.Context, id vocab.IRI) (document, error) {
+	errCtx := Ctx{"IRI": id}
+	st := time.Now()
+
+	// NOTE(marius): the documents cached before the domain was blocked are not to be served either
+	if err := c.allowed(id.String()); err != nil {
+		c.errFn(errCtx)("Error: %s", err)
+		return document{}, err
+	}
+	var cached *CacheEntry
+	if c.cache != nil {
+		if e, ok := c.cache.Load(id); ok {
+			if e.Fresh(st) {
+				c.infoFn(errCtx, Ctx{"duration": time.Now().Sub(st), "cache": "hit"})("OK")
+				return e.document(id), nil
+			}
+			cached = e
+		}
+	}
+
+	var fns []reqFn
+	if cached != nil {
+		fns = append(fns, cached.conditional)
+	}
+
+	var err error
 	var resp *http.Response
-	if resp, err = c.CtxGet(ctx, id.String()); err != nil {
+	if resp, err = c.do(ctx, id.String(), http.MethodGet, "", nil, fns...); err != nil {
 		c.errFn(errCtx)("Error: %s", err)
-		return obj, err
+		return document{}, err
 	}
 	if resp == nil {
 		err := errf("Unable to load from the AP end point: nil response").iri(id)
 		c.errFn(errCtx, Ctx{"duration": time.Now().Sub(st)})("Error: %s", err)
-		return obj, err
+		return document{}, err
 	}
 	// NOTE(marius): here we might want to group the Close with a Flush of the
 	// Body using io.Copy(ioutil.Discard, resp.Body)
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusGone {
-		var body []byte
-		var errReadAll error
-		if body, errReadAll = io.ReadAll(resp.Body); errReadAll != nil {
-			c.errFn(errCtx, Ctx{"duration": time.Now().Sub(st)}, Ctx{"status": resp.Status, "headers": resp.Header, "proto": resp.Proto})("errReadAll: %s", errReadAll)
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		c.storeCache(id, cached.revalidated(resp, st))
+		c.infoFn(errCtx, Ctx{"duration": time.Now().Sub(st), "status": resp.Status, "cache": "revalidated"})("OK")
+		return cached.document(id), nil
+	}
+
+	if resp.StatusCode == http.StatusGone {
+		if cached != nil {
+			if err := c.cache.Delete(id); err != nil {
+				c.errFn(errCtx)("Unable to remove cache entry: %s", err)
+			}
 		}
-		err := errf("Unable to load from the AP end point: invalid status %d %s", resp.StatusCode, body).iri(id)
-		c.errFn(errCtx, Ctx{"duration": time.Now().Sub(st)}, Ctx{"status": resp.Status, "body": string(body), "headers": resp.Header, "proto": resp.Proto})("Error: %s", err)
-		return obj, err
+		// NOTE(marius): we return the body together with the error, as it might contain a Tombstone
+		body, _ := io.ReadAll(resp.Body)
+		herr := HTTPError{StatusCode: resp.StatusCode, Header: resp.Header, Body: excerpt(body), IRI: id}
+		c.infoFn(errCtx, Ctx{"duration": time.Now().Sub(st), "status": resp.Status})("Gone")
+		return document{body: body, url: finalURL(resp, id)}, errf("Object has been deleted").iri(id).annotate(herr)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		herr := newHTTPError(resp, id)
+		err := errf("Unable to load from the AP end point").iri(id).annotate(herr)
+		c.errFn(errCtx, Ctx{"duration": time.Now().Sub(st)}, Ctx{"status": resp.Status, "body": string(herr.Body), "headers": resp.Header, "proto": resp.Proto})("Error: %s", err)
+		return document{}, err
 	}
 
-	var body []byte
-	if body, err = io.ReadAll(resp.Body); err != nil {
+	doc := document{url: finalURL(resp, id)}
+	if doc.body, err = io.ReadAll(resp.Body); err != nil {
 		c.errFn(errCtx, Ctx{"duration": time.Now().Sub(st)}, Ctx{"status": resp.Status, "headers": resp.Header, "proto": resp.Proto})("Error: %s", err)
-		return obj, err
+		return document{}, err
+	}
+	if e := newCacheEntry(resp, doc, st); e != nil {
+		c.storeCache(id, e)
 	}
 	c.infoFn(errCtx, Ctx{"duration": time.Now().Sub(st), "status": resp.Status})("OK")
 
-	return vocab.UnmarshalJSON(body)
+	return doc, nil
+}
+
+// finalURL returns the URL of the last request that was made for loading the resp response,
+// which differs from the id IRI when the server redirected us.
+func finalURL(resp *http.Response, id vocab.IRI) string {
+	if resp.Request != nil && resp.Request.URL != nil {
+		return resp.Request.URL.String()
+	}
+	return id.String()
 }
 
-// CtxLoadIRI tries to dereference an IRI and load the full ActivityPub object it represents
+// CtxLoadIRI tries to dereference an IRI and load the full ActivityPub object it represents.
+// For IRIs with a fragment, it returns the node the fragment identifies, from the document it belongs to.
+// For objects that have been deleted it returns a Tombstone, together with an error for which IsGone returns true.
 func (c C) CtxLoadIRI(ctx context.Context, id vocab.IRI) (vocab.Item, error) {
 	return c.loadCtx(ctx, id)
 }
 
-// LoadIRI tries to dereference an IRI and load the full ActivityPub object it represents
+// LoadIRI tries to dereference an IRI and load the full ActivityPub object it represents.
+// For IRIs with a fragment, it returns the node the fragment identifies, from the document it belongs to.
+// For objects that have been deleted it returns a Tombstone, together with an error for which IsGone returns true.
 func (c C) LoadIRI(id vocab.IRI) (vocab.Item, error) {
 	return c.loadCtx(context.Background(), id)
 }
@@ -248,7 +380,10 @@ func (c C) log(err error) CtxLogFn {
 	return logFn
 }
 
-func (c *C) req(ctx context.Context, method string, url, contentType string, body io.Reader) (*http.Request, error) {
+// reqFn is a function that modifies a request before it gets signed
+type reqFn func(*http.Request)
+
+func (c *C) req(ctx context.Context, method string, url, contentType string, body io.Reader, fns ...reqFn) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	req.Proto = "HTTP/2.0"
 	if err != nil {
@@ -271,6 +406,9 @@ func (c *C) req(ctx context.Context, method string, url, contentType string, bod
 	if host := req.Header.Get("Host"); host == "" {
 		req.Header.Set("Host", req.URL.Host)
 	}
+	for _, fn := range fns {
+		fn(req)
+	}
 	if err := c.signFn(req); err != nil {
 		c.errFn(Ctx{"method": req.Method, "iri": req.URL.String()})("Unable to sign request: %+s", err)
 	}
@@ -278,11 +416,45 @@ func (c *C) req(ctx context.Context, method string, url, contentType string, bod
 }
 
 func (c *C) Do(req *http.Request) (*http.Response, error) {
-	return c.c.Do(req)
+	if err := c.allowed(req.URL.String()); err != nil {
+		return nil, err
+	}
+	host := req.URL.Hostname()
+	if err := c.breaker.allow(host, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := c.limiter.wait(req.Context(), host); err != nil {
+		c.breaker.abandon(host)
+		return nil, err
+	}
+	resp, err := c.c.Do(req)
+	if req.Context().Err() != nil {
+		c.breaker.abandon(host)
+	} else {
+		c.breaker.record(host, resp, err, time.Now())
+	}
+	c.limiter.update(host, resp)
+	return resp, err
+}
+
+func (c C) do(ctx context.Context, url, method, contentType string, body io.Reader, fns ...reqFn) (*http.Response, error) {
+	if c.authFetch != nil && isFetch(method) {
+		return c.fetchAuthorized(ctx, url, method, fns...)
+	}
+	return c.doRequest(ctx, url, method, contentType, body, fns...)
 }
 
-func (c C) do(ctx context.Context, url, method, contentType string, body io.Reader) (*http.Response, error) {
-	req, err := c.req(ctx, method, url, contentType, body)
+// doRequest executes a request, retrying it on failure, if the client has a retry policy
+func (c C) doRequest(ctx context.Context, url, method, contentType string, body io.Reader, fns ...reqFn) (*http.Response, error) {
+	if c.retry != nil && c.retry.allows(method) {
+		return c.doWithRetry(ctx, url, method, contentType, body, fns...)
+	}
+	return c.send(ctx, url, method, contentType, body, fns...)
+}
+
+// send executes a single request, without retrying it on failure
+func (c C) send(ctx context.Context, url, method, contentType string, body io.Reader, fns ...reqFn) (*http.Response, error) {
+	req, err := c.req(ctx, method, url, contentType, body, fns...)
 	if err != nil {
 		return nil, err
 	}
@@ -334,20 +506,20 @@ func (c C) toCollection(ctx context.Context, url vocab.IRI, a vocab.Item) (vocab
 	}
 	var resp *http.Response
 	var iri vocab.IRI
-	resp, err = c.do(ctx, url.String(), http.MethodPost, ContentTypeActivityJson, bytes.NewReader(body))
+	resp, err = c.deliver(ctx, url, body)
 	if err != nil {
 		return iri, nil, err
 	}
 	iri = vocab.IRI(resp.Header.Get("Location"))
+	// NOTE(marius): here we might want to group the Close with a Flush of the
+	// Body using io.Copy(ioutil.Discard, resp.Body)
+	defer resp.Body.Close()
 
 	if resp.StatusCode >= http.StatusBadRequest && resp.StatusCode != http.StatusGone {
-		err := errors.FromResponse(resp)
+		err := newHTTPError(resp, url)
 		c.errFn(Ctx{"iri": url, "status": resp.Status})(err.Error())
-		return iri, nil, errf("invalid status received: %d", resp.StatusCode).iri(iri).annotate(err)
+		return iri, nil, errf("invalid status received: %d", resp.StatusCode).iri(url).annotate(err)
 	}
-	// NOTE(marius): here we might want to group the Close with a Flush of the
-	// Body using io.Copy(ioutil.Discard, resp.Body)
-	defer resp.Body.Close()
 	resBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		c.errFn(Ctx{"iri": url, "status": resp.Status})(err.Error())
@@ -1,6 +1,9 @@
 package client
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	vocab "github.com/mix/activitypub"
@@ -52,3 +55,59 @@ func TestClient_Put(t *testing.T) {
 func TestClient_Delete(t *testing.T) {
 	t.Skipf("TODO")
 }
+
+func TestClient_LoadIRI_gone(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   vocab.IRI
+	}{
+		{
+			name:   "gone with tombstone",
+			status: http.StatusGone,
+			body:   `{"id": "https://example.com/objects/1", "type": "Tombstone", "formerType": "Note"}`,
+			want:   "https://example.com/objects/1",
+		},
+		{
+			name:   "gone without tombstone",
+			status: http.StatusGone,
+			body:   `{"error": "Gone"}`,
+		},
+		{
+			name:   "ok with tombstone",
+			status: http.StatusOK,
+			body:   `{"id": "https://example.com/objects/1", "type": "Tombstone"}`,
+			want:   "https://example.com/objects/1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			if tt.want == "" {
+				tt.want = vocab.IRI(srv.URL)
+			}
+
+			c := New()
+			it, err := c.LoadIRI(vocab.IRI(srv.URL))
+			if !IsGone(err) {
+				t.Errorf("LoadIRI() error = %v, expected a gone error", err)
+			}
+			if vocab.IsNil(it) || it.GetType() != vocab.TombstoneType {
+				t.Fatalf("LoadIRI() = %v, expected a Tombstone", it)
+			}
+			if it.GetLink() != tt.want {
+				t.Errorf("LoadIRI() = %s, expected %s", it.GetLink(), tt.want)
+			}
+
+			act, err := c.Actor(context.Background(), vocab.IRI(srv.URL))
+			if act != nil || !IsGone(err) {
+				t.Errorf("Actor() = %v, %v, expected nil and a gone error", act, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/go-ap/jsonld"
+	vocab "github.com/mix/activitypub"
+)
+
+// DefaultDeliveryConcurrency is the default number of concurrent requests that Deliver makes
+const DefaultDeliveryConcurrency = 8
+
+// WithDeliveryConcurrency sets the maximum number of concurrent requests that Deliver makes,
+// both for dereferencing the recipients, and for posting to their inboxes.
+func WithDeliveryConcurrency(n int) OptionFn {
+	return func(c *C) error {
+		c.deliveryWorkers = n
+		return nil
+	}
+}
+
+// DeliveryResult is the outcome of delivering an activity to one inbox.
+type DeliveryResult struct {
+	// Inbox is the inbox the activity was posted to.
+	// It's empty if the inbox of the recipients could not be resolved.
+	Inbox vocab.IRI
+	// Recipients are the actors, or collections, that the activity reached through the Inbox
+	Recipients vocab.IRIs
+	// Status is the status code of the response of the remote server
+	Status int
+	// Err is the reason the delivery failed, nil on success
+	Err error
+}
+
+// Deliver posts the a activity to the inboxes of its recipients, as an ActivityPub server does for
+// server to server delivery.
+//
+// The recipients are computed from the "to", "cc", "bto", "bcc" and "audience" properties of the activity,
+// and the collections among them, like the followers of the author, are expanded by loading all their pages.
+// The recipients are dereferenced, and their shared inbox is used when they have one, so that every inbox
+// receives the activity only once. The recipients addressed only through "bto" and "bcc" receive the activity
+// in their own inbox, so the other recipients on their server don't find out about them. The author of the activity, and the recipients belonging to domains
+// not allowed by the domain policy of the client, are skipped.
+//
+// The "bto" and "bcc" properties are removed from the delivered copy of the activity, and of its object.
+// The a activity itself is not modified.
+//
+// The returned error is not nil only when the activity can't be delivered at all,
+// the outcome for each of the inboxes is in the DeliveryResult list.
+func (c C) Deliver(ctx context.Context, a vocab.Item) ([]DeliveryResult, error) {
+	if vocab.IsNil(a) {
+		return nil, errf("Unable to deliver nil activity")
+	}
+	var author vocab.IRI
+	var addressees, blind vocab.ItemCollection
+	err := vocab.OnIntransitiveActivity(a, func(act *vocab.IntransitiveActivity) error {
+		if !vocab.IsNil(act.Actor) {
+			author = act.Actor.GetLink()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errf("Unable to deliver item of type %s, it is not an activity", a.GetType()).iri(a.GetLink()).annotate(err)
+	}
+	a = c.filterRecipients(a)
+	vocab.OnObject(a, func(o *vocab.Object) error {
+		for _, col := range []vocab.ItemCollection{o.To, o.CC, o.Audience} {
+			addressees = append(addressees, col...)
+		}
+		blind = append(blind, o.Bto...)
+		blind = append(blind, o.BCC...)
+		return nil
+	})
+
+	body, err := jsonld.WithContext(jsonld.IRI(vocab.ActivityBaseURI), jsonld.IRI(vocab.SecurityContextURI)).Marshal(withoutBlindRecipients(a))
+	if err != nil {
+		return nil, errf("Unable to marshal activity").iri(a.GetLink()).annotate(err)
+	}
+
+	recipients, personal, results := c.expandRecipients(ctx, addressees, blind, author)
+	targets, failed := c.inboxes(ctx, recipients, personal)
+	results = append(results, failed...)
+
+	delivered := make([]DeliveryResult, len(targets))
+	c.parallel(len(targets), func(i int) {
+		delivered[i] = c.deliverTo(ctx, targets[i], body)
+	})
+	return append(results, delivered...), nil
+}
+
+// withoutBlindRecipients returns a copy of the it activity, without the "bto" and "bcc" properties,
+// neither on the activity, nor on the objects embedded in it.
+func withoutBlindRecipients(it vocab.Item) vocab.Item {
+	it = withoutBlind(it)
+	vocab.OnActivity(it, func(act *vocab.Activity) error {
+		if vocab.IsNil(act.Object) {
+			return nil
+		}
+		if col, ok := act.Object.(vocab.ItemCollection); ok {
+			objects := make(vocab.ItemCollection, 0, len(col))
+			for _, ob := range col {
+				objects = append(objects, withoutBlind(ob))
+			}
+			act.Object = objects
+			return nil
+		}
+		act.Object = withoutBlind(act.Object)
+		return nil
+	})
+	return it
+}
+
+// withoutBlind returns a copy of the it object, without its "bto" and "bcc" properties
+func withoutBlind(it vocab.Item) vocab.Item {
+	if vocab.IsNil(it) || !it.IsObject() {
+		return it
+	}
+	it = shallowCopy(it)
+	vocab.OnObject(it, func(o *vocab.Object) error {
+		o.Bto, o.BCC = nil, nil
+		return nil
+	})
+	return it
+}
+
+func isPublic(iri vocab.IRI) bool {
+	return iri == vocab.PublicNS || iri == "as:Public" || iri == "Public"
+}
+
+// expandRecipients dereferences the addressees and the blind addressees, and replaces the collections among them
+// with their items. It returns the deduplicated list of recipients, the ones among them that were reached only through
+// the blind addressees, and the failures to load any of the addressees.
+func (c C) expandRecipients(ctx context.Context, addressees, blind vocab.ItemCollection, author vocab.IRI) (vocab.ItemCollection, map[vocab.IRI]bool, []DeliveryResult) {
+	seen := map[vocab.IRI]struct{}{author: {}}
+	personal := make(map[vocab.IRI]bool)
+	skip := func(it vocab.Item) bool {
+		if vocab.IsNil(it) {
+			return true
+		}
+		iri := it.GetLink()
+		if _, ok := seen[iri]; ok || len(iri) == 0 || isPublic(iri) {
+			return true
+		}
+		seen[iri] = struct{}{}
+		if err := c.allowed(iri.String()); err != nil {
+			c.infoFn(Ctx{"IRI": iri})("Skipping recipient from blocked domain")
+			return true
+		}
+		return false
+	}
+
+	recipients := make(vocab.ItemCollection, 0, len(addressees))
+	failed := make([]DeliveryResult, 0)
+	// NOTE(marius): the blind addressees come last, so the recipients that are also addressed
+	// publicly are seen, and marked, as such
+	for i, r := range append(addressees[:len(addressees):len(addressees)], blind...) {
+		if skip(r) {
+			continue
+		}
+		isBlind := i >= len(addressees)
+		add := func(it vocab.Item) {
+			personal[it.GetLink()] = isBlind
+			recipients = append(recipients, it)
+		}
+		iri := r.GetLink()
+		if hasInbox(r) {
+			add(r)
+			continue
+		}
+		it, err := c.CtxLoadIRI(ctx, iri)
+		if err != nil {
+			failed = append(failed, DeliveryResult{Recipients: vocab.IRIs{iri}, Err: err})
+			continue
+		}
+		if vocab.IsNil(it) {
+			failed = append(failed, DeliveryResult{Recipients: vocab.IRIs{iri}, Err: errf("Unable to load recipient, nil item").iri(iri)})
+			continue
+		}
+		if !vocab.CollectionTypes.Contains(it.GetType()) {
+			add(it)
+			continue
+		}
+		// NOTE(marius): the collections are expanded only one level deep, their items are expected to be actors
+		members := c.Iterate(ctx, iri)
+		for members.Next() {
+			if m := members.Item(); !skip(m) {
+				add(m)
+			}
+		}
+		if err = members.Err(); err != nil {
+			failed = append(failed, DeliveryResult{Recipients: vocab.IRIs{iri}, Err: errf("Unable to load recipients collection").iri(iri).annotate(err)})
+		}
+	}
+	return recipients, personal, failed
+}
+
+// hasInbox checks if the it recipient is an embedded actor we can deliver to without dereferencing it
+func hasInbox(it vocab.Item) bool {
+	if !it.IsObject() || !vocab.ActorTypes.Contains(it.GetType()) {
+		return false
+	}
+	act, err := vocab.ToActor(it)
+	return err == nil && !vocab.IsNil(act.Inbox)
+}
+
+// inboxes dereferences the recipients that are not loaded already, and groups them by the inbox
+// we need to deliver to, which is their shared inbox when they have one, and they're not in personal.
+func (c C) inboxes(ctx context.Context, recipients vocab.ItemCollection, personal map[vocab.IRI]bool) ([]DeliveryResult, []DeliveryResult) {
+	resolved := make([]DeliveryResult, len(recipients))
+	c.parallel(len(recipients), func(i int) {
+		resolved[i] = c.recipientInbox(ctx, recipients[i], personal[recipients[i].GetLink()])
+	})
+
+	targets := make([]DeliveryResult, 0)
+	failed := make([]DeliveryResult, 0)
+	byInbox := make(map[vocab.IRI]int)
+	for _, r := range resolved {
+		if r.Err != nil {
+			failed = append(failed, r)
+			continue
+		}
+		if i, ok := byInbox[r.Inbox]; ok {
+			targets[i].Recipients = append(targets[i].Recipients, r.Recipients...)
+			continue
+		}
+		byInbox[r.Inbox] = len(targets)
+		targets = append(targets, r)
+	}
+	return targets, failed
+}
+
+// recipientInbox returns the inbox of the it recipient, preferring its shared inbox,
+// unless personal is set
+func (c C) recipientInbox(ctx context.Context, it vocab.Item, personal bool) DeliveryResult {
+	res := DeliveryResult{Recipients: vocab.IRIs{it.GetLink()}}
+	var act *vocab.Actor
+	if hasInbox(it) {
+		act, _ = vocab.ToActor(it)
+	} else if act, res.Err = c.Actor(ctx, it.GetLink()); res.Err != nil {
+		return res
+	}
+	if !personal && act.Endpoints != nil && !vocab.IsNil(act.Endpoints.SharedInbox) {
+		res.Inbox = act.Endpoints.SharedInbox.GetLink()
+	} else if !vocab.IsNil(act.Inbox) {
+		res.Inbox = act.Inbox.GetLink()
+	}
+	if len(res.Inbox) == 0 {
+		res.Err = errf("Recipient doesn't have an inbox").iri(act.ID)
+	} else if err := c.allowed(res.Inbox.String()); err != nil {
+		res.Err = errf("Recipient inbox belongs to a blocked domain").iri(act.ID).annotate(err)
+	}
+	return res
+}
+
+// deliverTo posts the body to the inbox of the target
+func (c C) deliverTo(ctx context.Context, target DeliveryResult, body []byte) DeliveryResult {
+	resp, err := c.deliver(ctx, target.Inbox, body)
+	if err != nil {
+		target.Err = err
+		return target
+	}
+	defer resp.Body.Close()
+
+	target.Status = resp.StatusCode
+	if resp.StatusCode >= http.StatusBadRequest {
+		target.Err = errf("Unable to deliver to inbox").iri(target.Inbox).annotate(newHTTPError(resp, target.Inbox))
+		c.errFn(Ctx{"iri": target.Inbox, "status": resp.Status})(target.Err.Error())
+	}
+	io.Copy(io.Discard, resp.Body)
+	return target
+}
+
+// parallel calls fn for every index in [0, n), with at most the configured number of concurrent calls
+func (c C) parallel(n int, fn func(i int)) {
+	workers := c.deliveryWorkers
+	if workers <= 0 {
+		workers = DefaultDeliveryConcurrency
+	}
+	sem := make(chan struct{}, workers)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
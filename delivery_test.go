@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestC_Deliver(t *testing.T) {
+	var m sync.Mutex
+	posted := make(map[string]string)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			m.Lock()
+			posted[r.URL.Path] = string(body)
+			m.Unlock()
+			if r.URL.Path == "/carol/inbox" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		switch r.URL.RequestURI() {
+		case "/followers":
+			w.Write([]byte(`{"id": "` + srv.URL + `/followers", "type": "OrderedCollection", "first": "` + srv.URL + `/followers?page=1"}`))
+		case "/followers?page=1":
+			w.Write([]byte(`{"id": "` + srv.URL + `/followers?page=1", "type": "OrderedCollectionPage", "next": "` + srv.URL + `/followers?page=2",
+				"orderedItems": ["` + srv.URL + `/alice", "` + srv.URL + `/bob", "` + srv.URL + `/author"]}`))
+		case "/followers?page=2":
+			w.Write([]byte(`{"id": "` + srv.URL + `/followers?page=2", "type": "OrderedCollectionPage", "orderedItems": ["` + srv.URL + `/carol"]}`))
+		case "/alice", "/bob", "/dave":
+			w.Write([]byte(`{"id": "` + srv.URL + r.URL.Path + `", "type": "Person", "inbox": "` + srv.URL + r.URL.Path + `/inbox",
+				"endpoints": {"sharedInbox": "` + srv.URL + `/shared"}}`))
+		case "/carol":
+			w.Write([]byte(`{"id": "` + srv.URL + r.URL.Path + `", "type": "Person", "inbox": "` + srv.URL + r.URL.Path + `/inbox"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	act := &vocab.Activity{
+		ID:    vocab.IRI(srv.URL + "/activities/1"),
+		Type:  vocab.CreateType,
+		Actor: vocab.IRI(srv.URL + "/author"),
+		To:    vocab.ItemCollection{vocab.PublicNS, vocab.IRI(srv.URL + "/followers")},
+		CC:    vocab.ItemCollection{vocab.IRI(srv.URL + "/alice")},
+		BCC:   vocab.ItemCollection{vocab.IRI(srv.URL + "/dave"), vocab.IRI(srv.URL + "/missing")},
+		Object: &vocab.Object{
+			Type:    vocab.NoteType,
+			Content: vocab.DefaultNaturalLanguageValue("hello"),
+			BCC:     vocab.ItemCollection{vocab.IRI(srv.URL + "/dave")},
+		},
+	}
+
+	res, err := New(WithDeliveryConcurrency(2)).Deliver(context.Background(), act)
+	if err != nil {
+		t.Fatalf("Deliver() error = %s", err)
+	}
+	if note, _ := vocab.ToObject(act.Object); len(act.BCC) != 2 || len(note.BCC) != 1 {
+		t.Errorf("Deliver() modified the bcc of the activity: %v, %v", act.BCC, note.BCC)
+	}
+
+	byInbox := make(map[vocab.IRI]DeliveryResult)
+	for _, r := range res {
+		byInbox[r.Inbox] = r
+	}
+	if len(res) != 4 || len(byInbox) != 4 {
+		t.Fatalf("Deliver() = %+v, expected 3 inboxes and a failed recipient", res)
+	}
+	if shared := byInbox[vocab.IRI(srv.URL+"/shared")]; shared.Err != nil || shared.Status != http.StatusAccepted || len(shared.Recipients) != 2 {
+		t.Errorf("Shared inbox result = %+v, expected alice and bob to share the delivery", shared)
+	}
+	if dave := byInbox[vocab.IRI(srv.URL+"/dave/inbox")]; dave.Err != nil {
+		t.Errorf("Bcc recipient result = %+v, expected a successful delivery to its own inbox", dave)
+	}
+	if carol := byInbox[vocab.IRI(srv.URL+"/carol/inbox")]; carol.Err == nil || carol.Status != http.StatusInternalServerError {
+		t.Errorf("Failed inbox result = %+v, expected an error", carol)
+	}
+	if missing := byInbox[""]; missing.Err == nil || len(missing.Recipients) != 1 || missing.Recipients[0] != vocab.IRI(srv.URL+"/missing") {
+		t.Errorf("Unresolved recipient result = %+v, expected an error", missing)
+	}
+
+	if len(posted) != 3 {
+		t.Errorf("Posted to %d inboxes, expected 3: %v", len(posted), posted)
+	}
+	for inbox, body := range posted {
+		if strings.Contains(body, `"bcc"`) || strings.Contains(body, `"bto"`) {
+			t.Errorf("Activity posted to %s contains the blind recipients: %s", inbox, body)
+		}
+	}
+}
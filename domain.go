@@ -0,0 +1,259 @@
+package client
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-ap/errors"
+	vocab "github.com/mix/activitypub"
+)
+
+// DomainPolicy decides which domains the client is allowed to interact with
+type DomainPolicy interface {
+	Allowed(domain string) bool
+}
+
+// DomainBlockedError is returned for requests that have not been sent because the domain policy of the client
+// doesn't allow interacting with the remote domain
+type DomainBlockedError struct {
+	Domain string
+}
+
+func (e DomainBlockedError) Error() string {
+	return fmt.Sprintf("domain %s is blocked", e.Domain)
+}
+
+// IsDomainBlocked returns true if the err error was caused by a request to a domain blocked by the domain policy
+func IsDomainBlocked(err error) bool {
+	return errors.As(err, new(DomainBlockedError))
+}
+
+// WithDomainPolicy sets the policy checked before every request the client makes, including the ones
+// following redirects. Requests to domains that are not allowed return a DomainBlockedError.
+func WithDomainPolicy(p DomainPolicy) OptionFn {
+	return func(c *C) error {
+		c.domains = p
+		if p == nil {
+			return nil
+		}
+		// NOTE(marius): we don't modify the http.Client in place, as it can be shared with other clients
+		hc := *c.c
+		next := hc.CheckRedirect
+		hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if !p.Allowed(req.URL.Hostname()) {
+				return DomainBlockedError{Domain: req.URL.Hostname()}
+			}
+			if next != nil {
+				return next(req, via)
+			}
+			if len(via) >= 10 {
+				return errors.Newf("stopped after 10 redirects")
+			}
+			return nil
+		}
+		c.c = &hc
+		return nil
+	}
+}
+
+// DomainRules is a DomainPolicy built from lists of allowed and denied domains.
+// A domain is allowed if it's not in the Deny list and, when the Allow list is not nil, if it's in the Allow list.
+type DomainRules struct {
+	Allow *DomainList
+	Deny  *DomainList
+}
+
+// Allowed returns true if the domain is allowed by the rules
+func (r DomainRules) Allowed(domain string) bool {
+	if r.Deny.Contains(domain) {
+		return false
+	}
+	return r.Allow == nil || r.Allow.Contains(domain)
+}
+
+// DomainList is a list of domains, safe for concurrent use.
+// Its entries can be exact domains, like "example.com", or wildcards, like "*.example.com",
+// which match all the subdomains of example.com, but not example.com itself.
+type DomainList struct {
+	m         sync.RWMutex
+	exact     map[string]struct{}
+	wildcards map[string]struct{}
+}
+
+// NewDomainList creates a DomainList containing the domains
+func NewDomainList(domains ...string) *DomainList {
+	l := &DomainList{exact: make(map[string]struct{}), wildcards: make(map[string]struct{})}
+	l.Add(domains...)
+	return l
+}
+
+// Add appends the domains to the l list
+func (l *DomainList) Add(domains ...string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for _, d := range domains {
+		if strings.HasPrefix(d, "*.") {
+			l.wildcards[normalizeDomain(d[2:])] = struct{}{}
+			continue
+		}
+		l.exact[normalizeDomain(d)] = struct{}{}
+	}
+}
+
+// Remove removes the domains from the l list
+func (l *DomainList) Remove(domains ...string) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	for _, d := range domains {
+		if strings.HasPrefix(d, "*.") {
+			delete(l.wildcards, normalizeDomain(d[2:]))
+			continue
+		}
+		delete(l.exact, normalizeDomain(d))
+	}
+}
+
+// Contains returns true if the domain matches any of the entries of the l list
+func (l *DomainList) Contains(domain string) bool {
+	if l == nil {
+		return false
+	}
+	domain = normalizeDomain(domain)
+
+	l.m.RLock()
+	defer l.m.RUnlock()
+	if _, ok := l.exact[domain]; ok {
+		return true
+	}
+	for i := strings.IndexByte(domain, '.'); i >= 0; i = strings.IndexByte(domain, '.') {
+		domain = domain[i+1:]
+		if _, ok := l.wildcards[domain]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeDomain(d string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), ".")
+}
+
+// LoadMastodonDomainBlocks loads the suspended domains from a domain block list in the CSV format
+// exported by Mastodon, which has a "#domain,#severity,..." header. Lists without a header, containing only
+// domains, are supported too.
+// Mastodon blocks apply to subdomains too, so for every domain both the exact and wildcard entries are added.
+// Silenced domains are ignored, as they can still federate.
+func LoadMastodonDomainBlocks(r io.Reader) (*DomainList, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	l := NewDomainList()
+	domainCol, severityCol := 0, -1
+	for line := 0; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "Unable to parse domain blocks")
+		}
+		if line == 0 && len(rec) > 0 && strings.HasPrefix(rec[0], "#") {
+			for i, col := range rec {
+				switch strings.TrimPrefix(strings.TrimSpace(col), "#") {
+				case "domain":
+					domainCol = i
+				case "severity":
+					severityCol = i
+				}
+			}
+			continue
+		}
+		if domainCol >= len(rec) {
+			continue
+		}
+		domain := normalizeDomain(rec[domainCol])
+		if len(domain) == 0 {
+			continue
+		}
+		if severityCol >= 0 && severityCol < len(rec) {
+			if sev := strings.TrimSpace(rec[severityCol]); sev != "" && sev != "suspend" {
+				continue
+			}
+		}
+		l.Add(domain, "*."+domain)
+	}
+	return l, nil
+}
+
+// allowed checks the host of the u URL against the domain policy of the client
+func (c C) allowed(u string) error {
+	if c.domains == nil {
+		return nil
+	}
+	uu, err := url.Parse(u)
+	if err != nil {
+		return nil
+	}
+	if host := uu.Hostname(); !c.domains.Allowed(host) {
+		return DomainBlockedError{Domain: host}
+	}
+	return nil
+}
+
+// filterRecipients returns a copy of the it activity, without the recipients belonging to domains
+// that are not allowed by the domain policy, in its addressing properties.
+func (c C) filterRecipients(it vocab.Item) vocab.Item {
+	if c.domains == nil || vocab.IsNil(it) {
+		return it
+	}
+	it = shallowCopy(it)
+	vocab.OnObject(it, func(o *vocab.Object) error {
+		o.To = c.allowedRecipients(o.To)
+		o.CC = c.allowedRecipients(o.CC)
+		o.Bto = c.allowedRecipients(o.Bto)
+		o.BCC = c.allowedRecipients(o.BCC)
+		o.Audience = c.allowedRecipients(o.Audience)
+		return nil
+	})
+	return it
+}
+
+// shallowCopy returns a copy of the it item, which shares the values of its properties with it.
+// Items that are not pointers to structs, like IRIs, are returned as they are.
+func shallowCopy(it vocab.Item) vocab.Item {
+	v := reflect.ValueOf(it)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return it
+	}
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	if i, ok := cp.Interface().(vocab.Item); ok {
+		return i
+	}
+	return it
+}
+
+func (c C) allowedRecipients(col vocab.ItemCollection) vocab.ItemCollection {
+	if len(col) == 0 {
+		return col
+	}
+	res := make(vocab.ItemCollection, 0, len(col))
+	for _, r := range col {
+		if vocab.IsNil(r) {
+			continue
+		}
+		if id := r.GetLink(); id != vocab.PublicNS && c.allowed(id.String()) != nil {
+			c.infoFn(Ctx{"IRI": id})("Removing recipient from blocked domain")
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestDomainList_Contains(t *testing.T) {
+	l := NewDomainList("example.com", "*.evil.social", "Mixed.Case.")
+	tests := map[string]bool{
+		"example.com":      true,
+		"EXAMPLE.com":      true,
+		"sub.example.com":  false,
+		"evil.social":      false,
+		"a.evil.social":    true,
+		"a.b.evil.social":  true,
+		"notevil.social":   false,
+		"mixed.case":       true,
+		"example.org":      false,
+		"":                 false,
+		"com":              false,
+		"xample.com":       false,
+		"a.evil.social.":   true,
+		"evil.social.fake": false,
+	}
+	for domain, want := range tests {
+		if got := l.Contains(domain); got != want {
+			t.Errorf("Contains(%q) = %t, expected %t", domain, got, want)
+		}
+	}
+}
+
+func TestLoadMastodonDomainBlocks(t *testing.T) {
+	data := `#domain,#severity,#reject_media,#reject_reports,#public_comment,#obfuscate
+suspended.example,suspend,false,false,"spam, lots of it",false
+silenced.example,silence,true,false,,false
+other.example,suspend,false,false,,true
+`
+	l, err := LoadMastodonDomainBlocks(strings.NewReader(data))
+	if err != nil {
+		t.Fatalf("LoadMastodonDomainBlocks() error = %s", err)
+	}
+	for domain, want := range map[string]bool{"suspended.example": true, "sub.suspended.example": true, "other.example": true, "silenced.example": false} {
+		if got := l.Contains(domain); got != want {
+			t.Errorf("Contains(%q) = %t, expected %t", domain, got, want)
+		}
+	}
+
+	l, err = LoadMastodonDomainBlocks(strings.NewReader("plain.example\n"))
+	if err != nil || !l.Contains("plain.example") {
+		t.Errorf("LoadMastodonDomainBlocks() = %v, %v, expected the domains of a list without header to be loaded", l, err)
+	}
+}
+
+func TestWithDomainPolicy(t *testing.T) {
+	var posted []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			posted, _ = io.ReadAll(r.Body)
+		}
+		switch r.URL.Path {
+		case "/redirect":
+			u, _ := url.Parse("http://" + r.Host)
+			http.Redirect(w, r, "http://localhost:"+u.Port()+"/", http.StatusFound)
+		case "/outbox":
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(WithDomainPolicy(DomainRules{Deny: NewDomainList("localhost", "*.blocked.example")}))
+	if _, err := c.Get(strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)); !IsDomainBlocked(err) {
+		t.Errorf("Get() error = %v, expected a domain blocked error", err)
+	}
+	if _, err := c.Get(srv.URL + "/redirect"); !IsDomainBlocked(err) {
+		t.Errorf("Get() error = %v, expected a domain blocked error for the redirect", err)
+	}
+	if c.c == defaultClient {
+		t.Errorf("WithDomainPolicy() should not modify the default client")
+	}
+	req, _ := http.NewRequest(http.MethodGet, "https://a.blocked.example/", nil)
+	if _, err := c.Do(req); !IsDomainBlocked(err) {
+		t.Errorf("Do() error = %v, expected a domain blocked error", err)
+	}
+
+	cache := NewMemCache()
+	cache.Store("https://a.blocked.example/note", &CacheEntry{Body: []byte(`{"type": "Note"}`), Expires: time.Now().Add(time.Hour)})
+	cached := New(WithCache(cache), WithDomainPolicy(DomainRules{Deny: NewDomainList("*.blocked.example")}))
+	if _, err := cached.LoadIRI("https://a.blocked.example/note"); !IsDomainBlocked(err) {
+		t.Errorf("LoadIRI() error = %v, expected a domain blocked error for the cached document", err)
+	}
+
+	act := &vocab.Activity{
+		Type:  vocab.CreateType,
+		Actor: &vocab.Actor{ID: vocab.IRI(srv.URL + "/actor"), Outbox: vocab.IRI(srv.URL + "/outbox")},
+		To:    vocab.ItemCollection{vocab.PublicNS, vocab.IRI("https://ok.example/jane")},
+		CC:    vocab.ItemCollection{vocab.IRI("https://a.blocked.example/john")},
+	}
+	if _, _, err := c.ToOutbox(context.Background(), act); err != nil {
+		t.Fatalf("ToOutbox() error = %s", err)
+	}
+	if bytes.Contains(posted, []byte("blocked.example")) || !bytes.Contains(posted, []byte("ok.example")) {
+		t.Errorf("ToOutbox() posted %s, expected the recipient on the blocked domain to be removed", posted)
+	}
+	if len(act.To) != 2 || len(act.CC) != 1 {
+		t.Errorf("ToOutbox() recipients = %v %v, expected the activity to not be modified", act.To, act.CC)
+	}
+}
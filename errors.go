@@ -3,8 +3,10 @@ package client
 import (
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
+	"github.com/go-ap/errors"
 	vocab "github.com/mix/activitypub"
 )
 
@@ -64,6 +66,86 @@ func (e err) Format(s fmt.State, verb rune) {
 	}
 }
 
+// maxErrorBodyLen is the maximum length of the response body excerpt kept in a HTTPError
+const maxErrorBodyLen = 1024
+
+// HTTPError is the error returned for requests to which the remote server responded with an error status.
+// It can be retrieved from the errors returned by the client using errors.As.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	// Body is an excerpt of the response body, at most 1024 bytes long
+	Body []byte
+	IRI  vocab.IRI
+}
+
+func newHTTPError(resp *http.Response, i vocab.IRI) HTTPError {
+	e := HTTPError{StatusCode: resp.StatusCode, Header: resp.Header, IRI: i}
+	if resp.Body != nil {
+		e.Body, _ = io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLen))
+	}
+	return e
+}
+
+func excerpt(body []byte) []byte {
+	if len(body) > maxErrorBodyLen {
+		return body[:maxErrorBodyLen]
+	}
+	return body
+}
+
+// Error returns the formatted error
+func (e HTTPError) Error() string {
+	s := strings.Builder{}
+	s.WriteString(fmt.Sprintf("invalid status %d %s", e.StatusCode, http.StatusText(e.StatusCode)))
+	if len(e.Body) > 0 {
+		s.WriteString(": ")
+		s.Write(e.Body)
+	}
+	return s.String()
+}
+
+func hasStatus(err error, status int) bool {
+	e := HTTPError{}
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+// StatusCode returns the status of the response that caused the err error,
+// or 0 if the error was not caused by an error response.
+func StatusCode(err error) int {
+	e := HTTPError{}
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound returns true if the error was caused by a "404 Not Found" response
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound) || errors.IsNotFound(err)
+}
+
+// IsGone returns true if the error was caused by a "410 Gone" response
+func IsGone(err error) bool {
+	return hasStatus(err, http.StatusGone) || errors.IsGone(err)
+}
+
+// IsUnauthorized returns true if the error was caused by a "401 Unauthorized" response
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized) || errors.IsUnauthorized(err)
+}
+
+// IsForbidden returns true if the error was caused by a "403 Forbidden" response
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden) || errors.IsForbidden(err)
+}
+
+// IsRateLimited returns true if the error was caused by a "429 Too Many Requests" response,
+// or by a request that was not sent because of the rate limit of the remote host
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests) || errors.As(err, new(RateLimitedError))
+}
+
 type logger struct {
 	ctx     Ctx
 	infoFn  func(string, ...interface{})
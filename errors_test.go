@@ -1,9 +1,13 @@
 package client
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
+	"github.com/go-ap/errors"
 	vocab "github.com/mix/activitypub"
 )
 
@@ -20,3 +24,40 @@ func TestErr_Error(t *testing.T) {
 		t.Errorf("error message should contain the 'test' string")
 	}
 }
+
+func TestHTTPError(t *testing.T) {
+	status := http.StatusNotFound
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "test")
+		w.WriteHeader(status)
+		w.Write([]byte(strings.Repeat("x", 2*maxErrorBodyLen)))
+	}))
+	defer srv.Close()
+	iri := vocab.IRI(srv.URL)
+	c := New()
+
+	_, err := c.LoadIRI(iri)
+	if !IsNotFound(err) {
+		t.Errorf("LoadIRI() error = %v, expected a not found error", err)
+	}
+	e := HTTPError{}
+	if !errors.As(err, &e) {
+		t.Fatalf("LoadIRI() error = %v, expected a HTTPError", err)
+	}
+	if e.IRI != iri || e.Header.Get("X-Test") != "test" || len(e.Body) != maxErrorBodyLen {
+		t.Errorf("HTTPError = %+v, expected the IRI, headers and body excerpt of the response", e)
+	}
+
+	status = http.StatusUnauthorized
+	if _, err = c.Actor(context.Background(), iri); !IsUnauthorized(err) {
+		t.Errorf("Actor() error = %v, expected an unauthorized error", err)
+	}
+	status = http.StatusForbidden
+	if _, err = c.Collection(context.Background(), iri); StatusCode(err) != http.StatusForbidden {
+		t.Errorf("Collection() error = %v, expected a forbidden error", err)
+	}
+	status = http.StatusTooManyRequests
+	if _, _, err = c.ToCollection(iri, vocab.Activity{Type: vocab.CreateType}); !IsRateLimited(err) {
+		t.Errorf("ToCollection() error = %v, expected a rate limited error", err)
+	}
+}
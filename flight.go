@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+// flight coalesces concurrent loads of the same IRI into a single request, in the same way
+// golang.org/x/sync/singleflight does, but taking into account the contexts of the callers:
+// a caller whose context gets cancelled returns early, without affecting the others, and the shared
+// request is cancelled only when all the callers waiting for it have given up.
+type flight struct {
+	m     sync.Mutex
+	calls map[vocab.IRI]*call
+}
+
+type call struct {
+	done    chan struct{}
+	doc     document
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+type loadFn func(context.Context, vocab.IRI) (document, error)
+
+func (f *flight) do(ctx context.Context, iri vocab.IRI, fn loadFn) (document, error) {
+	if f == nil {
+		return fn(ctx, iri)
+	}
+	f.m.Lock()
+	if f.calls == nil {
+		f.calls = make(map[vocab.IRI]*call)
+	}
+	c, ok := f.calls[iri]
+	if !ok {
+		fctx, cancel := context.WithCancel(detached{ctx})
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		f.calls[iri] = c
+		go f.run(fctx, iri, c, fn)
+	}
+	c.waiters++
+	f.m.Unlock()
+
+	select {
+	case <-c.done:
+		return c.doc, c.err
+	case <-ctx.Done():
+		f.m.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			f.forget(iri, c)
+		}
+		f.m.Unlock()
+		return document{}, ctx.Err()
+	}
+}
+
+func (f *flight) run(ctx context.Context, iri vocab.IRI, c *call, fn loadFn) {
+	c.doc, c.err = fn(ctx, iri)
+
+	f.m.Lock()
+	f.forget(iri, c)
+	f.m.Unlock()
+
+	c.cancel()
+	close(c.done)
+}
+
+// forget removes the c call from the list of calls in progress, if it's still the current one for iri.
+// It must be called with the lock held.
+func (f *flight) forget(iri vocab.IRI, c *call) {
+	if f.calls[iri] == c {
+		delete(f.calls, iri)
+	}
+}
+
+// detached is a context that keeps the values of its parent, but not its deadline or cancellation.
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestC_CtxLoadIRI_coalesce(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Write([]byte(`{"id": "https://example.com/actors/jdoe", "type": "Person"}`))
+	}))
+	defer srv.Close()
+
+	c := New()
+	iri := vocab.IRI(srv.URL)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancelledErr := make(chan error)
+	go func() {
+		_, err := c.CtxLoadIRI(cancelled, iri)
+		cancelledErr <- err
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			it, err := c.CtxLoadIRI(context.Background(), iri)
+			if err != nil {
+				t.Errorf("CtxLoadIRI() error = %s", err)
+				return
+			}
+			if it.GetLink() != "https://example.com/actors/jdoe" {
+				t.Errorf("CtxLoadIRI() returned %s", it.GetLink())
+			}
+		}()
+	}
+	// NOTE(marius): give the goroutines time to join the request in progress
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	if err := <-cancelledErr; err != context.Canceled {
+		t.Errorf("CtxLoadIRI() error = %v for the cancelled caller, expected %v", err, context.Canceled)
+	}
+
+	close(release)
+	wg.Wait()
+	if requests := atomic.LoadInt32(&requests); requests != 1 {
+		t.Errorf("server received %d requests, expected 1", requests)
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/go-ap/errors"
+	vocab "github.com/mix/activitypub"
+)
+
+// documentIRI returns the IRI of the document containing the node identified by the id IRI,
+// which is the IRI without its fragment.
+func documentIRI(id vocab.IRI) vocab.IRI {
+	u, err := id.URL()
+	if err != nil || len(u.Fragment) == 0 {
+		return id
+	}
+	u.Fragment = ""
+	return vocab.IRI(u.String())
+}
+
+// fragmentNode locates the node identified by the id IRI, which contains a fragment, in the body
+// of the document it belongs to, eg: the "publicKey" of an actor for https://example.com/actor#main-key.
+//
+// NOTE(marius): nodes of types that the vocabulary doesn't know, like the Key and Multikey public keys,
+// are returned as Objects keeping their type, but only the generic properties.
+// For loading public keys, the KeyResolver should be used.
+func fragmentNode(body []byte, id vocab.IRI) (vocab.Item, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, errf("Unable to parse document").iri(id).annotate(err)
+	}
+	node := findNode(doc, id.String())
+	if node == nil {
+		return nil, errors.NotFoundf("Unable to find node %s in its document", id)
+	}
+	raw, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	if it, err := vocab.UnmarshalJSON(raw); err == nil && !vocab.IsNil(it) {
+		return it, nil
+	}
+	ob := new(vocab.Object)
+	if err := ob.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	return ob, nil
+}
+
+// findNode searches depth first, for the JSON object having the id identifier
+func findNode(v any, id string) map[string]any {
+	switch vv := v.(type) {
+	case map[string]any:
+		if nid, ok := vv["id"].(string); ok && nid == id {
+			return vv
+		}
+		for _, val := range vv {
+			if n := findNode(val, id); n != nil {
+				return n
+			}
+		}
+	case []any:
+		for _, val := range vv {
+			if n := findNode(val, id); n != nil {
+				return n
+			}
+		}
+	}
+	return nil
+}
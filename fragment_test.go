@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestC_CtxLoadIRI_fragment(t *testing.T) {
+	requests := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(`{"id": "` + srv.URL + `/actor", "type": "Person",
+			"publicKey": {"id": "` + srv.URL + `/actor#main-key", "type": "Key", "owner": "` + srv.URL + `/actor", "publicKeyPem": "-"},
+			"attachment": [{"id": "` + srv.URL + `/actor#note", "type": "Note", "content": "hello"}]}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := New(WithCache(NewMemCache()))
+	if it, err := c.CtxLoadIRI(ctx, vocab.IRI(srv.URL+"/actor")); err != nil || it.GetType() != vocab.PersonType {
+		t.Fatalf("CtxLoadIRI() = %v, %v", it, err)
+	}
+
+	it, err := c.CtxLoadIRI(ctx, vocab.IRI(srv.URL+"/actor#note"))
+	if err != nil {
+		t.Fatalf("CtxLoadIRI() error = %s", err)
+	}
+	if ob, _ := vocab.ToObject(it); ob == nil || ob.Type != vocab.NoteType || ob.Content.First().Value.String() != "hello" {
+		t.Errorf("CtxLoadIRI() = %v, expected the embedded Note", it)
+	}
+
+	it, err = c.CtxLoadIRI(ctx, vocab.IRI(srv.URL+"/actor#main-key"))
+	if err != nil {
+		t.Fatalf("CtxLoadIRI() error = %s", err)
+	}
+	if it.GetLink() != vocab.IRI(srv.URL+"/actor#main-key") || it.GetType() != "Key" {
+		t.Errorf("CtxLoadIRI() = %v, expected the public key node", it)
+	}
+
+	if it, err = c.CtxLoadIRI(ctx, vocab.IRI(srv.URL+"/actor#missing")); !IsNotFound(err) {
+		t.Errorf("CtxLoadIRI() = %v, %v, expected a not found error", it, err)
+	}
+	if requests != 1 {
+		t.Errorf("Sent %d requests, expected the fragment IRIs to share the document with the actor", requests)
+	}
+}
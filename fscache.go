@@ -0,0 +1,231 @@
+package client
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+	vocab "github.com/mix/activitypub"
+)
+
+// FSCache is a Cache implementation that stores the entries on disk, one file per IRI,
+// grouped in a folder for every host.
+// When the total size of the stored files exceeds the configured maximum, the least recently
+// used entries get evicted.
+type FSCache struct {
+	path    string
+	maxSize int64
+
+	m    sync.Mutex
+	size int64
+}
+
+type fsCacheEntry struct {
+	IRI vocab.IRI `json:"iri"`
+	CacheEntry
+}
+
+// NewFSCache creates a new cache that stores its entries under the path folder.
+// A maxSize value of 0 means the size of the cache is not bounded.
+func NewFSCache(path string, maxSize int64) (*FSCache, error) {
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, errors.Annotatef(err, "unable to create cache folder %s", path)
+	}
+	f := FSCache{path: path, maxSize: maxSize}
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if fi, err := d.Info(); err == nil {
+			f.size += fi.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "unable to read cache folder %s", path)
+	}
+	return &f, nil
+}
+
+// Load returns the entry stored for the iri IRI, if any
+func (f *FSCache) Load(iri vocab.IRI) (*CacheEntry, bool) {
+	p := f.file(iri)
+	if p == "" {
+		return nil, false
+	}
+	raw, err := os.ReadFile(p)
+	if err != nil {
+		return nil, false
+	}
+	e := fsCacheEntry{}
+	if err = json.Unmarshal(raw, &e); err != nil || e.IRI != iri {
+		return nil, false
+	}
+	// NOTE(marius): we use the modification time of the files for evicting the least recently used entries
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return &e.CacheEntry, true
+}
+
+// Store saves the e entry for the iri IRI
+func (f *FSCache) Store(iri vocab.IRI, e *CacheEntry) error {
+	if e == nil {
+		return nil
+	}
+	p := f.file(iri)
+	if p == "" {
+		return errf("unable to store entry, invalid IRI").iri(iri)
+	}
+	raw, err := json.Marshal(fsCacheEntry{IRI: iri, CacheEntry: *e})
+	if err != nil {
+		return errf("unable to marshal cache entry").iri(iri).annotate(err)
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return errf("unable to create cache folder").iri(iri).annotate(err)
+	}
+	tmp := p + ".tmp"
+	if err = os.WriteFile(tmp, raw, 0600); err != nil {
+		return errf("unable to write cache entry").iri(iri).annotate(err)
+	}
+	var old int64
+	if fi, err := os.Stat(p); err == nil {
+		old = fi.Size()
+	}
+	if err = os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return errf("unable to write cache entry").iri(iri).annotate(err)
+	}
+	f.size += int64(len(raw)) - old
+	if f.maxSize > 0 && f.size > f.maxSize {
+		return f.evict(p)
+	}
+	return nil
+}
+
+// Delete removes the entry stored for the iri IRI
+func (f *FSCache) Delete(iri vocab.IRI) error {
+	p := f.file(iri)
+	if p == "" {
+		return nil
+	}
+	f.m.Lock()
+	defer f.m.Unlock()
+	return f.remove(p)
+}
+
+// PurgeHost removes all the entries belonging to the host
+func (f *FSCache) PurgeHost(host string) error {
+	dir := f.hostDir(host)
+	if dir == "" {
+		return errors.Newf("invalid cache host %q", host)
+	}
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Annotatef(err, "unable to read cache folder for host %s", host)
+	}
+	for _, d := range entries {
+		if err = f.remove(filepath.Join(dir, d.Name())); err != nil {
+			return err
+		}
+	}
+	return os.Remove(dir)
+}
+
+func (f *FSCache) remove(p string) error {
+	fi, err := os.Stat(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err = os.Remove(p); err != nil {
+		return err
+	}
+	f.size -= fi.Size()
+	return nil
+}
+
+// evict removes the least recently used entries until the size of the cache is below its maximum size.
+// The keep file, which is the one that has just been written, is never removed.
+func (f *FSCache) evict(keep string) error {
+	type file struct {
+		path string
+		mod  time.Time
+	}
+	files := make([]file, 0)
+	err := filepath.WalkDir(f.path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || p == keep {
+			return err
+		}
+		if fi, err := d.Info(); err == nil {
+			files = append(files, file{path: p, mod: fi.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mod.Before(files[j].mod)
+	})
+	for _, ff := range files {
+		if f.size <= f.maxSize {
+			break
+		}
+		if err = f.remove(ff.path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FSCache) file(iri vocab.IRI) string {
+	u, err := iri.URL()
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	dir := f.hostDir(u.Host)
+	if dir == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(iri))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// hostDir returns the folder holding the entries of the host,
+// or an empty string if the host can't be mapped to a folder inside the cache
+func (f *FSCache) hostDir(host string) string {
+	folder := hostFolder(host)
+	if folder == "" || folder == "." || folder == ".." {
+		return ""
+	}
+	dir := filepath.Join(f.path, folder)
+	if filepath.Dir(dir) != filepath.Clean(f.path) {
+		return ""
+	}
+	return dir
+}
+
+func hostFolder(host string) string {
+	return strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(strings.ToLower(host))
+}
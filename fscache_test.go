@@ -0,0 +1,111 @@
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestFSCache(t *testing.T) {
+	f, err := NewFSCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewFSCache() error = %s", err)
+	}
+	iri := vocab.IRI("https://example.com/actors/jdoe")
+	e := CacheEntry{
+		Body:    []byte(`{"id":"https://example.com/actors/jdoe","type":"Person"}`),
+		ETag:    `"etag"`,
+		Expires: time.Now().Add(time.Hour).Round(time.Second),
+	}
+	if err = f.Store(iri, &e); err != nil {
+		t.Fatalf("Store() error = %s", err)
+	}
+	got, ok := f.Load(iri)
+	if !ok {
+		t.Fatalf("Load() didn't find the stored entry")
+	}
+	if !bytes.Equal(got.Body, e.Body) || got.ETag != e.ETag || !got.Expires.Equal(e.Expires) {
+		t.Errorf("Load() = %+v, expected %+v", got, e)
+	}
+	if _, ok = f.Load("https://example.com/actors/other"); ok {
+		t.Errorf("Load() found an entry for an IRI that wasn't stored")
+	}
+
+	if err = f.PurgeHost("example.com"); err != nil {
+		t.Fatalf("PurgeHost() error = %s", err)
+	}
+	if _, ok = f.Load(iri); ok {
+		t.Errorf("Load() found an entry after purging its host")
+	}
+	if f.size != 0 {
+		t.Errorf("cache size is %d after purging all entries, expected 0", f.size)
+	}
+
+	for _, host := range []string{"..", ".", ""} {
+		if err = f.Store(vocab.IRI("https://"+host+"/x"), &e); err == nil {
+			t.Errorf("Store() should have failed for host %q", host)
+		}
+		if err = f.PurgeHost(host); err == nil {
+			t.Errorf("PurgeHost() should have failed for host %q", host)
+		}
+	}
+}
+
+func TestFSCache_evict(t *testing.T) {
+	e := CacheEntry{Body: bytes.Repeat([]byte{'a'}, 100)}
+	f, err := NewFSCache(t.TempDir(), 500)
+	if err != nil {
+		t.Fatalf("NewFSCache() error = %s", err)
+	}
+	iris := []vocab.IRI{"https://example.com/1", "https://example.com/2", "https://example.com/3", "https://example.com/4"}
+	for i, iri := range iris {
+		if err = f.Store(iri, &e); err != nil {
+			t.Fatalf("Store() error = %s", err)
+		}
+		// NOTE(marius): make sure the modification times differ
+		mod := time.Now().Add(time.Duration(i-len(iris)) * time.Minute)
+		if err = os.Chtimes(f.file(iri), mod, mod); err != nil {
+			t.Fatalf("unable to change modification time: %s", err)
+		}
+	}
+	if f.size > f.maxSize {
+		t.Errorf("cache size %d is over the maximum %d", f.size, f.maxSize)
+	}
+	if _, ok := f.Load(iris[0]); ok {
+		t.Errorf("Load() found the oldest entry, which should have been evicted")
+	}
+	if _, ok := f.Load(iris[len(iris)-1]); !ok {
+		t.Errorf("Load() didn't find the newest entry")
+	}
+}
+
+func TestC_LoadIRI_offline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Write([]byte(`{"id": "https://example.com/1", "type": "Note"}`))
+	}))
+	iri := vocab.IRI(srv.URL)
+
+	f, err := NewFSCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("NewFSCache() error = %s", err)
+	}
+	if _, err = New(WithCache(f)).LoadIRI(iri); err != nil {
+		t.Fatalf("LoadIRI() error = %s", err)
+	}
+	srv.Close()
+
+	// NOTE(marius): a new client, simulating a restart of the process
+	it, err := New(WithCache(f)).LoadIRI(iri)
+	if err != nil {
+		t.Fatalf("LoadIRI() error = %s, with the server offline", err)
+	}
+	if it.GetLink() != "https://example.com/1" {
+		t.Errorf("LoadIRI() returned %s", it.GetLink())
+	}
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CavageSigner signs requests with HTTP Signatures, as described by draft-cavage-http-signatures-12,
+// which is the version used by most ActivityPub servers for server to server interactions.
+//
+// It can be plugged in the client using its Sign method: New(WithSignFn(signer.Sign))
+type CavageSigner struct {
+	// KeyID is the IRI of the public key, usually the "publicKey" of the actor the requests are made as
+	KeyID string
+	// Key is the private key, which can be either a *rsa.PrivateKey, or an ed25519.PrivateKey
+	Key crypto.PrivateKey
+	// Now returns the current time, it's used for setting the Date header of the requests.
+	// When nil, time.Now is used.
+	Now func() time.Time
+}
+
+// Sign adds the Date, Digest (for requests with a body) and Signature headers to the req request.
+// The signature covers the "(request-target)", "host", "date" and, when present, the "digest" headers.
+func (s CavageSigner) Sign(req *http.Request) error {
+	if s.Key == nil {
+		return errf("Unable to sign request, nil private key")
+	}
+	if len(s.KeyID) == 0 {
+		return errf("Unable to sign request, empty key id")
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	req.Header.Set("Date", now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if digest, err := bodyDigest(req); err != nil {
+		return err
+	} else if len(digest) > 0 {
+		req.Header.Set("Digest", digest)
+		headers = append(headers, "digest")
+	}
+
+	sig, alg, err := signWithKey(s.Key, []byte(cavageSigningString(req, headers)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature", fmt.Sprintf(`keyId="%s",algorithm="%s",headers="%s",signature="%s"`,
+		s.KeyID, alg, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// cavageSigningString builds the string that gets signed, from the values of the headers of the req request.
+func cavageSigningString(req *http.Request, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		var val string
+		switch h {
+		case "(request-target)":
+			val = strings.ToLower(req.Method) + " " + req.URL.RequestURI()
+		case "host":
+			val = requestHost(req)
+		default:
+			val = strings.Join(req.Header.Values(h), ", ")
+		}
+		lines = append(lines, h+": "+val)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func requestHost(req *http.Request) string {
+	if h := req.Header.Get("Host"); len(h) > 0 {
+		return h
+	}
+	if len(req.Host) > 0 {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// bodyDigest returns the value of the Digest header for the body of the req request, or an empty string
+// if the request doesn't have a body.
+func bodyDigest(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	var body []byte
+	var err error
+	if req.GetBody != nil {
+		var rc io.ReadCloser
+		if rc, err = req.GetBody(); err != nil {
+			return "", errf("Unable to read request body").annotate(err)
+		}
+		body, err = io.ReadAll(rc)
+		rc.Close()
+	} else {
+		// NOTE(marius): the body can't be read again, so we replace it with a copy
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	if err != nil {
+		return "", errf("Unable to read request body").annotate(err)
+	}
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// signWithKey signs the data with the key, returning the signature and the name of the algorithm used
+func signWithKey(key crypto.PrivateKey, data []byte) ([]byte, string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256(data)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+		if err != nil {
+			return nil, "", errf("Unable to sign request").annotate(err)
+		}
+		return sig, "rsa-sha256", nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, data), "hs2019", nil
+	case *ed25519.PrivateKey:
+		return signWithKey(*k, data)
+	}
+	return nil, "", errf("Unsupported private key type %T", key)
+}
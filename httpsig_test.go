@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+var (
+	testEd25519Key = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{0x42}, ed25519.SeedSize))
+	testNow        = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	sigRe          = regexp.MustCompile(`^keyId="([^"]+)",algorithm="([^"]+)",headers="([^"]+)",signature="([^"]+)"$`)
+)
+
+func TestCavageSigner_Sign(t *testing.T) {
+	s := CavageSigner{KeyID: "https://example.com/actor#main-key", Key: testEd25519Key, Now: testNow}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/inbox?page=1", bytes.NewReader([]byte(`{"type":"Follow"}`)))
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Sign() error = %s", err)
+	}
+
+	if d := req.Header.Get("Date"); d != "Tue, 02 Jan 2024 03:04:05 GMT" {
+		t.Errorf("Date = %s", d)
+	}
+	if d := req.Header.Get("Digest"); d != "SHA-256=GYwYnH3BiO6aICFt0ThC5bUIJ4byvqdpWtR8m5fNkww=" {
+		t.Errorf("Digest = %s", d)
+	}
+	wantStr := "(request-target): post /inbox?page=1\nhost: example.com\ndate: Tue, 02 Jan 2024 03:04:05 GMT\ndigest: SHA-256=GYwYnH3BiO6aICFt0ThC5bUIJ4byvqdpWtR8m5fNkww="
+	if got := cavageSigningString(req, []string{"(request-target)", "host", "date", "digest"}); got != wantStr {
+		t.Errorf("cavageSigningString() = %q, expected %q", got, wantStr)
+	}
+	want := `keyId="https://example.com/actor#main-key",algorithm="hs2019",headers="(request-target) host date digest",signature="jhfg343I0k90HTOARR/hcQb+z+WidUHcEI8P1+cXyB+S4G8m6iAR7iivYfRV55bvc0WSK71V4s0jN+iLmzTIDw=="`
+	if got := req.Header.Get("Signature"); got != want {
+		t.Errorf("Signature = %s, expected %s", got, want)
+	}
+	m := sigRe.FindStringSubmatch(req.Header.Get("Signature"))
+	if m == nil {
+		t.Fatalf("Invalid Signature header %s", req.Header.Get("Signature"))
+	}
+	sig, _ := base64.StdEncoding.DecodeString(m[4])
+	if !ed25519.Verify(testEd25519Key.Public().(ed25519.PublicKey), []byte(wantStr), sig) {
+		t.Errorf("Signature doesn't verify")
+	}
+	if body, _ := io.ReadAll(req.Body); string(body) != `{"type":"Follow"}` {
+		t.Errorf("Request body = %s, expected it to be unchanged", body)
+	}
+}
+
+func TestCavageSigner_Sign_rsa(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	s := CavageSigner{KeyID: "https://example.com/actor#main-key", Key: key, Now: testNow}
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/actor", nil)
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Sign() error = %s", err)
+	}
+	if d := req.Header.Get("Digest"); d != "" {
+		t.Errorf("Digest = %s, expected no digest for requests without body", d)
+	}
+	m := sigRe.FindStringSubmatch(req.Header.Get("Signature"))
+	if m == nil || m[2] != "rsa-sha256" || m[3] != "(request-target) host date" {
+		t.Fatalf("Invalid Signature header %s", req.Header.Get("Signature"))
+	}
+	sig, _ := base64.StdEncoding.DecodeString(m[4])
+	sum := sha256.Sum256([]byte(cavageSigningString(req, []string{"(request-target)", "host", "date"})))
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, sum[:], sig); err != nil {
+		t.Errorf("Signature doesn't verify: %s", err)
+	}
+}
+
+func TestWithSignFn_cavage(t *testing.T) {
+	var sig, digest string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sig, digest = r.Header.Get("Signature"), r.Header.Get("Digest")
+	}))
+	defer srv.Close()
+
+	c := New(WithSignFn(CavageSigner{KeyID: "https://example.com/actor#main-key", Key: testEd25519Key}.Sign))
+	if _, _, err := c.ToCollection(vocab.IRI(srv.URL+"/inbox"), &vocab.Activity{Type: vocab.FollowType}); err != nil {
+		t.Fatalf("ToCollection() error = %s", err)
+	}
+	if sig == "" || digest == "" {
+		t.Errorf("Request was not signed: Signature = %q, Digest = %q", sig, digest)
+	}
+}
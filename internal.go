@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"fmt"
 	"net/http"
+
+	errs "github.com/go-ap/errors"
 )
 
 // ErrorHandlerFunc is a data type for the default ErrorHandler function of the package
@@ -14,11 +16,15 @@ type ErrorHandlerFunc func(...error) http.HandlerFunc
 var ErrorHandler ErrorHandlerFunc = func(errors ...error) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		output := bytes.Buffer{}
+		status := http.StatusInternalServerError
 		for i, e := range errors {
 			output.WriteString(fmt.Sprintf("#%d %s\n", i, e.Error()))
+			if i == 0 {
+				status = errs.HttpStatus(e)
+			}
 		}
-		w.WriteHeader(http.StatusInternalServerError)
 		w.Header().Add("Content-Type", "text/plain")
+		w.WriteHeader(status)
 		w.Write(output.Bytes())
 	}
 }
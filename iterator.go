@@ -0,0 +1,306 @@
+package client
+
+import (
+	"context"
+
+	vocab "github.com/mix/activitypub"
+)
+
+// Iterator walks over the items of an ActivityPub collection, following the "first" and "next"
+// links of the collection and of its pages until there are no more pages left to load.
+// When created with IterateReverse, it follows the "last" and "prev" links instead, and it returns
+// the items of every page in reverse order.
+//
+// The typical usage is:
+//
+//	it := c.Iterate(ctx, iri).Limit(100, 0)
+//	for it.Next() {
+//		item := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type Iterator struct {
+	c   C
+	ctx context.Context
+
+	// next is the next page we need to load, it can be either an IRI or an inline page object
+	next    vocab.Item
+	reverse bool
+	// skip is the number of items to skip, starting with the first loaded page, when resuming from a Cursor
+	skip int
+	// root is the IRI the iteration started from, and walked is the number of items of the pages before
+	// the current one, counted from root, which we use for the cursors of the pages without an IRI
+	root   vocab.IRI
+	walked int
+
+	page    vocab.CollectionInterface
+	pageIRI vocab.IRI
+	items   vocab.ItemCollection
+	pos     int
+	cur     vocab.Item
+
+	seen     map[vocab.IRI]struct{}
+	maxItems int
+	maxPages int
+	itemCnt  int
+	pageCnt  int
+
+	err  error
+	done bool
+}
+
+// Iterate returns an Iterator over the items of the collection found at the i IRI.
+// The filters are applied only to the initial request, the subsequent pages are loaded
+// using the IRIs provided by the remote server.
+func (c C) Iterate(ctx context.Context, i vocab.IRI, filters ...FilterFn) *Iterator {
+	start := iri(i, filters...)
+	return &Iterator{
+		c:    c,
+		ctx:  ctx,
+		next: start,
+		root: start,
+		seen: make(map[vocab.IRI]struct{}),
+	}
+}
+
+// IterateReverse returns an Iterator over the items of the collection found at the i IRI,
+// that starts from the last page of the collection and walks towards the first one.
+func (c C) IterateReverse(ctx context.Context, i vocab.IRI, filters ...FilterFn) *Iterator {
+	it := c.Iterate(ctx, i, filters...)
+	it.reverse = true
+	return it
+}
+
+// Resume returns an Iterator that continues from the position saved in the cur Cursor.
+func (c C) Resume(ctx context.Context, cur Cursor) *Iterator {
+	it := c.Iterate(ctx, cur.Page)
+	it.reverse = cur.Reverse
+	it.skip = cur.Offset
+	return it
+}
+
+// Limit sets the maximum number of items and pages the Iterator will load.
+// A value of 0 means there is no limit.
+func (it *Iterator) Limit(maxItems, maxPages int) *Iterator {
+	it.maxItems = maxItems
+	it.maxPages = maxPages
+	return it
+}
+
+// Next advances the Iterator to the next item of the collection, loading the following page if needed.
+// It returns false when there are no more items, when one of the limits has been reached,
+// or when an error occurred, in which case it can be retrieved with Err.
+func (it *Iterator) Next() bool {
+	it.cur = nil
+	if it.maxItems > 0 && it.itemCnt >= it.maxItems {
+		it.done = true
+	}
+	for !it.done && it.pos >= len(it.items) {
+		if !it.NextPage() {
+			return false
+		}
+	}
+	if it.done {
+		return false
+	}
+	it.cur = it.items[it.pos]
+	it.pos++
+	it.itemCnt++
+	return true
+}
+
+// Item returns the current item of the Iterator.
+func (it *Iterator) Item() vocab.Item {
+	return it.cur
+}
+
+// NextPage advances the Iterator to the next page of the collection, skipping the remaining items
+// of the current one. The items of the newly loaded page are then returned by subsequent calls to Next.
+func (it *Iterator) NextPage() bool {
+	if it.done {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		return it.fail(err)
+	}
+	if vocab.IsNil(it.next) {
+		it.done = true
+		return false
+	}
+	if it.maxPages > 0 && it.pageCnt >= it.maxPages {
+		it.done = true
+		return false
+	}
+	if _, ok := it.seen[it.next.GetLink()]; ok && len(it.next.GetLink()) > 0 {
+		// NOTE(marius): the remote server returned a page we have already visited, we stop here
+		// to avoid looping indefinitely
+		it.done = true
+		return false
+	}
+
+	col, err := it.load(it.next)
+	if err != nil {
+		return it.fail(err)
+	}
+	it.pageIRI = col.GetLink()
+	if id := it.next.GetLink(); len(id) > 0 {
+		it.seen[id] = struct{}{}
+		if len(it.pageIRI) == 0 {
+			it.pageIRI = id
+		}
+	}
+	if len(it.pageIRI) > 0 {
+		it.seen[it.pageIRI] = struct{}{}
+	}
+	it.cur = nil
+	it.walked += len(it.items)
+	it.pos = 0
+	it.page = col
+	it.items = nil
+	it.next = nil
+
+	switch col.GetType() {
+	case vocab.CollectionType, vocab.OrderedCollectionType:
+		start := firstPage(col)
+		if it.reverse {
+			start = lastPage(col)
+		}
+		if !vocab.IsNil(start) {
+			// NOTE(marius): the collection is paginated, we don't count it as a page,
+			// and we move on to its first (or last) page
+			it.next = start
+			return it.NextPage()
+		}
+		it.items = col.Collection()
+	default:
+		it.items = col.Collection()
+		it.next = nextPage(col)
+		if it.reverse {
+			it.next = prevPage(col)
+		}
+	}
+	if it.reverse {
+		it.items = reversed(it.items)
+	}
+	if it.skip > 0 {
+		// NOTE(marius): the offsets of the cursors for pages without an IRI can span multiple pages
+		it.pos = it.skip
+		if it.pos > len(it.items) {
+			it.pos = len(it.items)
+		}
+		it.skip -= it.pos
+	}
+	it.pageCnt++
+	return true
+}
+
+// Cursor returns the current position of the Iterator.
+// It can be serialized and used later with C.Resume to continue iterating from the same position.
+//
+// When the current page is embedded in its collection, without an IRI of its own, the cursor points
+// to the IRI the iteration started from, and its offset counts all the items consumed since then.
+func (it *Iterator) Cursor() Cursor {
+	if it.page == nil {
+		return Cursor{Page: it.next.GetLink(), Offset: it.skip, Reverse: it.reverse}
+	}
+	if len(it.pageIRI) == 0 {
+		return Cursor{Page: it.root, Offset: it.walked + it.pos, Reverse: it.reverse}
+	}
+	return Cursor{Page: it.pageIRI, Offset: it.pos, Reverse: it.reverse}
+}
+
+// Page returns the collection page the current item belongs to.
+func (it *Iterator) Page() vocab.CollectionInterface {
+	return it.page
+}
+
+// Err returns the error that stopped the Iterator, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Cursor represents a position inside a paged collection: the IRI of a page and the number of
+// items, starting with that page, that have already been consumed.
+type Cursor struct {
+	Page    vocab.IRI `json:"page"`
+	Offset  int       `json:"offset,omitempty"`
+	Reverse bool      `json:"reverse,omitempty"`
+}
+
+func (it *Iterator) fail(err error) bool {
+	it.err = err
+	it.done = true
+	return false
+}
+
+func (it *Iterator) load(page vocab.Item) (vocab.CollectionInterface, error) {
+	if page.IsObject() {
+		if col, ok := page.(vocab.CollectionInterface); ok && isInlinePage(col) {
+			return col, nil
+		}
+	}
+	return it.c.collection(it.ctx, page.GetLink())
+}
+
+// isInlinePage checks if a page embedded in its parent collection can be used without dereferencing it.
+// Some servers include only the id and type of the page, which means we need to load it.
+func isInlinePage(col vocab.CollectionInterface) bool {
+	return len(col.Collection()) > 0 || !vocab.IsNil(nextPage(col)) || !vocab.IsNil(prevPage(col))
+}
+
+func firstPage(col vocab.Item) vocab.Item {
+	switch c := col.(type) {
+	case *vocab.Collection:
+		return c.First
+	case *vocab.OrderedCollection:
+		return c.First
+	case *vocab.CollectionPage:
+		return c.First
+	case *vocab.OrderedCollectionPage:
+		return c.First
+	}
+	return nil
+}
+
+func lastPage(col vocab.Item) vocab.Item {
+	switch c := col.(type) {
+	case *vocab.Collection:
+		return c.Last
+	case *vocab.OrderedCollection:
+		return c.Last
+	case *vocab.CollectionPage:
+		return c.Last
+	case *vocab.OrderedCollectionPage:
+		return c.Last
+	}
+	return nil
+}
+
+func prevPage(col vocab.Item) vocab.Item {
+	switch c := col.(type) {
+	case *vocab.CollectionPage:
+		return c.Prev
+	case *vocab.OrderedCollectionPage:
+		return c.Prev
+	}
+	return nil
+}
+
+func reversed(items vocab.ItemCollection) vocab.ItemCollection {
+	rev := make(vocab.ItemCollection, len(items))
+	for i, it := range items {
+		rev[len(items)-1-i] = it
+	}
+	return rev
+}
+
+func nextPage(col vocab.Item) vocab.Item {
+	switch c := col.(type) {
+	case *vocab.CollectionPage:
+		return c.Next
+	case *vocab.OrderedCollectionPage:
+		return c.Next
+	}
+	return nil
+}
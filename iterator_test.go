@@ -0,0 +1,217 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func mockCollectionServer(t *testing.T, pages map[string]string) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		body, ok := pages[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeActivityJson)
+		fmt.Fprintf(w, body, srv.URL)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestC_Iterate(t *testing.T) {
+	srv := mockCollectionServer(t, map[string]string{
+		"/outbox":        `{"id": "%[1]s/outbox", "type": "OrderedCollection", "totalItems": 5, "first": "%[1]s/outbox?page=1"}`,
+		"/outbox?page=1": `{"id": "%[1]s/outbox?page=1", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/1", "%[1]s/2"], "next": "%[1]s/outbox?page=2"}`,
+		"/outbox?page=2": `{"id": "%[1]s/outbox?page=2", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/3", "%[1]s/4"], "next": "%[1]s/outbox?page=3"}`,
+		"/outbox?page=3": `{"id": "%[1]s/outbox?page=3", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/5"], "next": "%[1]s/outbox?page=1"}`,
+		"/inline":        `{"id": "%[1]s/inline", "type": "Collection", "first": {"id": "%[1]s/inline?page=1", "type": "CollectionPage", "items": ["%[1]s/1"], "next": "%[1]s/inline?page=2"}}`,
+		"/inline?page=2": `{"id": "%[1]s/inline?page=2", "type": "CollectionPage", "items": ["%[1]s/5"], "next": "%[1]s/inline?page=1"}`,
+	})
+	base := vocab.IRI(srv.URL)
+
+	tests := []struct {
+		name     string
+		iri      vocab.IRI
+		maxItems int
+		maxPages int
+		want     []vocab.IRI
+		pages    int
+	}{
+		{
+			name:  "follows next until cycle",
+			iri:   base.AddPath("outbox"),
+			want:  []vocab.IRI{base.AddPath("1"), base.AddPath("2"), base.AddPath("3"), base.AddPath("4"), base.AddPath("5")},
+			pages: 3,
+		},
+		{
+			name:     "max items",
+			iri:      base.AddPath("outbox"),
+			maxItems: 3,
+			want:     []vocab.IRI{base.AddPath("1"), base.AddPath("2"), base.AddPath("3")},
+			pages:    2,
+		},
+		{
+			name:     "max pages",
+			iri:      base.AddPath("outbox"),
+			maxPages: 1,
+			want:     []vocab.IRI{base.AddPath("1"), base.AddPath("2")},
+			pages:    1,
+		},
+		{
+			name:  "inline first page",
+			iri:   base.AddPath("inline"),
+			want:  []vocab.IRI{base.AddPath("1"), base.AddPath("5")},
+			pages: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := New().Iterate(context.Background(), tt.iri).Limit(tt.maxItems, tt.maxPages)
+			got := make([]vocab.IRI, 0)
+			for it.Next() {
+				got = append(got, it.Item().GetLink())
+			}
+			if err := it.Err(); err != nil {
+				t.Fatalf("Iterate() error = %s", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Iterate() returned %d items, expected %d: %v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Iterate() item #%d = %s, expected %s", i, got[i], tt.want[i])
+				}
+			}
+			if it.pageCnt != tt.pages {
+				t.Errorf("Iterate() loaded %d pages, expected %d", it.pageCnt, tt.pages)
+			}
+		})
+	}
+}
+
+func TestC_Iterate_cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	it := New().Iterate(ctx, "https://example.com/outbox")
+	if it.Next() {
+		t.Errorf("Next() should have returned false for a cancelled context")
+	}
+	if it.Err() != context.Canceled {
+		t.Errorf("Err() = %v, expected %v", it.Err(), context.Canceled)
+	}
+}
+
+func TestC_IterateReverse(t *testing.T) {
+	srv := mockCollectionServer(t, map[string]string{
+		"/outbox":        `{"id": "%[1]s/outbox", "type": "OrderedCollection", "first": "%[1]s/outbox?page=1", "last": "%[1]s/outbox?page=2"}`,
+		"/outbox?page=1": `{"id": "%[1]s/outbox?page=1", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/1", "%[1]s/2"], "next": "%[1]s/outbox?page=2"}`,
+		"/outbox?page=2": `{"id": "%[1]s/outbox?page=2", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/3", "%[1]s/4"], "prev": "%[1]s/outbox?page=1"}`,
+	})
+	base := vocab.IRI(srv.URL)
+
+	it := New().IterateReverse(context.Background(), base.AddPath("outbox"))
+	want := []vocab.IRI{base.AddPath("4"), base.AddPath("3"), base.AddPath("2"), base.AddPath("1")}
+	for i, w := range want {
+		if !it.Next() {
+			t.Fatalf("Next() returned false at item #%d: %v", i, it.Err())
+		}
+		if got := it.Item().GetLink(); got != w {
+			t.Errorf("Item() #%d = %s, expected %s", i, got, w)
+		}
+	}
+	if it.Next() {
+		t.Errorf("Next() should have returned false after the first page")
+	}
+}
+
+func TestC_Resume(t *testing.T) {
+	srv := mockCollectionServer(t, map[string]string{
+		"/outbox":        `{"id": "%[1]s/outbox", "type": "OrderedCollection", "first": "%[1]s/outbox?page=1"}`,
+		"/outbox?page=1": `{"id": "%[1]s/outbox?page=1", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/1", "%[1]s/2"], "next": "%[1]s/outbox?page=2"}`,
+		"/outbox?page=2": `{"id": "%[1]s/outbox?page=2", "type": "OrderedCollectionPage", "orderedItems": ["%[1]s/3", "%[1]s/4"]}`,
+	})
+	base := vocab.IRI(srv.URL)
+	c := New()
+
+	it := c.Iterate(context.Background(), base.AddPath("outbox"))
+	for i := 0; i < 3; i++ {
+		it.Next()
+	}
+	raw, err := json.Marshal(it.Cursor())
+	if err != nil {
+		t.Fatalf("unable to marshal cursor: %s", err)
+	}
+	cur := Cursor{}
+	if err = json.Unmarshal(raw, &cur); err != nil {
+		t.Fatalf("unable to unmarshal cursor: %s", err)
+	}
+	if cur.Page != vocab.IRI(srv.URL+"/outbox?page=2") || cur.Offset != 1 {
+		t.Errorf("Cursor() = %+v, expected page 2 with offset 1", cur)
+	}
+
+	page, err := c.CollectionAt(context.Background(), cur)
+	if err != nil {
+		t.Fatalf("CollectionAt() error = %s", err)
+	}
+	if items := page.Collection(); len(items) != 1 || items[0].GetLink() != base.AddPath("4") || page.GetLink() != cur.Page {
+		t.Errorf("CollectionAt() = %s %v, expected page 2 with only the remaining item", page.GetLink(), items)
+	}
+
+	it = c.Resume(context.Background(), cur)
+	if !it.Next() {
+		t.Fatalf("Next() returned false after resuming: %v", it.Err())
+	}
+	if got := it.Item().GetLink(); got != base.AddPath("4") {
+		t.Errorf("Item() = %s after resuming, expected %s", got, base.AddPath("4"))
+	}
+	if it.Next() {
+		t.Errorf("Next() should have returned false at the end of the collection")
+	}
+}
+
+func TestC_Resume_inlinePages(t *testing.T) {
+	srv := mockCollectionServer(t, map[string]string{
+		"/outbox": `{"id": "%[1]s/outbox", "type": "OrderedCollection", "first": {"type": "OrderedCollectionPage",
+			"orderedItems": ["%[1]s/1", "%[1]s/2"], "next": {"type": "OrderedCollectionPage", "orderedItems": ["%[1]s/3", "%[1]s/4"]}}}`,
+	})
+	base := vocab.IRI(srv.URL)
+	c := New()
+
+	it := c.Iterate(context.Background(), base.AddPath("outbox"))
+	for i := 0; i < 3; i++ {
+		it.Next()
+	}
+	cur := it.Cursor()
+	if cur.Page != base.AddPath("outbox") || cur.Offset != 3 {
+		t.Errorf("Cursor() = %+v, expected the collection with offset 3", cur)
+	}
+
+	it = c.Resume(context.Background(), cur)
+	if !it.Next() || it.Item().GetLink() != base.AddPath("4") {
+		t.Errorf("Item() = %v after resuming, expected %s: %v", it.Item(), base.AddPath("4"), it.Err())
+	}
+	if it.Next() {
+		t.Errorf("Next() should have returned false at the end of the collection")
+	}
+
+	page, err := c.CollectionAt(context.Background(), cur)
+	if err != nil {
+		t.Fatalf("CollectionAt() error = %s", err)
+	}
+	if items := page.Collection(); len(items) != 1 || items[0].GetLink() != base.AddPath("4") {
+		t.Errorf("CollectionAt() items = %v, expected only the remaining item", items)
+	}
+}
@@ -0,0 +1,329 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-ap/errors"
+	vocab "github.com/mix/activitypub"
+)
+
+// DefaultKeyTTL is the default duration for which the KeyResolver keeps the resolved keys
+const DefaultKeyTTL = time.Hour
+
+// maxCachedKeys is the number of keys after which the KeyResolver starts evicting the expired ones
+const maxCachedKeys = 10000
+
+// ResolvedKey is a public key, as resolved from its key id
+type ResolvedKey struct {
+	// ID is the key id
+	ID vocab.IRI
+	// Owner is the IRI of the actor that owns the key
+	Owner vocab.IRI
+	// Key is the public key, either an *rsa.PublicKey, or an ed25519.PublicKey
+	Key crypto.PublicKey
+
+	actor   *vocab.Actor
+	expires time.Time
+	// cached is true if the key was loaded from the resolver's cache, instead of the remote server
+	cached bool
+}
+
+// KeyResolver dereferences key ids, like the ones found in HTTP signatures, into public keys.
+// A key id can point to:
+//
+//   - a public key embedded in an actor document, in its "publicKey" property: https://example.com/actor#main-key
+//   - a standalone key document, with an "owner" or "controller" property: https://example.com/actor/main-key
+//   - a FEP-521a Multikey, embedded in the "assertionMethod" property of an actor document.
+//
+// The resolved keys are cached for the configured TTL.
+type KeyResolver struct {
+	c   *C
+	ttl time.Duration
+	now func() time.Time
+
+	m    sync.Mutex
+	keys map[vocab.IRI]*ResolvedKey
+}
+
+// NewKeyResolver creates a KeyResolver which loads the keys using the c client, and caches them for ttl.
+// A zero ttl uses DefaultKeyTTL, and a negative one disables caching.
+func NewKeyResolver(c *C, ttl time.Duration) *KeyResolver {
+	if ttl == 0 {
+		ttl = DefaultKeyTTL
+	}
+	return &KeyResolver{c: c, ttl: ttl, now: time.Now, keys: make(map[vocab.IRI]*ResolvedKey)}
+}
+
+// Resolve returns the public key identified by the keyID IRI.
+func (r *KeyResolver) Resolve(ctx context.Context, keyID vocab.IRI) (*ResolvedKey, error) {
+	return r.resolve(ctx, keyID, false)
+}
+
+// Forget removes the keyID key from the cache, so the next resolution loads it again from its origin.
+func (r *KeyResolver) Forget(keyID vocab.IRI) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	delete(r.keys, keyID)
+}
+
+func (r *KeyResolver) resolve(ctx context.Context, keyID vocab.IRI, refresh bool) (*ResolvedKey, error) {
+	if r.c == nil {
+		return nil, errf("Unable to resolve key, nil client").iri(keyID)
+	}
+	now := time.Now
+	if r.now != nil {
+		now = r.now
+	}
+	if !refresh {
+		if k, ok := r.cached(keyID, now()); ok {
+			return k, nil
+		}
+	}
+
+	doc := documentIRI(keyID)
+	if refresh && r.c.cache != nil {
+		// NOTE(marius): the key might have been rotated, so the cached document is stale too
+		if err := r.c.cache.Delete(doc); err != nil {
+			r.c.errFn(Ctx{"IRI": doc})("Unable to remove cache entry: %s", err)
+		}
+	}
+	k, err := r.c.loadKey(ctx, keyID, doc)
+	if err != nil {
+		return nil, err
+	}
+	if r.ttl > 0 {
+		k.expires = now().Add(r.ttl)
+		r.store(k, now())
+	}
+	return k, nil
+}
+
+func (r *KeyResolver) cached(keyID vocab.IRI, now time.Time) (*ResolvedKey, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	k, ok := r.keys[keyID]
+	if !ok || now.After(k.expires) {
+		return nil, false
+	}
+	kk := *k
+	kk.cached = true
+	return &kk, true
+}
+
+func (r *KeyResolver) store(k *ResolvedKey, now time.Time) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.keys == nil {
+		r.keys = make(map[vocab.IRI]*ResolvedKey)
+	}
+	if len(r.keys) >= maxCachedKeys {
+		for id, kk := range r.keys {
+			if now.After(kk.expires) {
+				delete(r.keys, id)
+			}
+		}
+	}
+	if len(r.keys) >= maxCachedKeys {
+		for id := range r.keys {
+			delete(r.keys, id)
+			break
+		}
+	}
+	r.keys[k.ID] = k
+}
+
+// keyNode is the raw JSON representation of the documents containing keys: actors, Key and Multikey objects
+type keyNode struct {
+	ID                 vocab.IRI       `json:"id"`
+	Owner              vocab.IRI       `json:"owner"`
+	Controller         vocab.IRI       `json:"controller"`
+	PublicKeyPem       string          `json:"publicKeyPem"`
+	PublicKeyMultibase string          `json:"publicKeyMultibase"`
+	PublicKey          json.RawMessage `json:"publicKey"`
+	AssertionMethod    json.RawMessage `json:"assertionMethod"`
+}
+
+// nodes decodes raw, which can be either a JSON object, or an array of JSON objects.
+// Bare IRIs are ignored.
+func nodes(raw json.RawMessage) []keyNode {
+	if len(raw) == 0 {
+		return nil
+	}
+	var one keyNode
+	if err := json.Unmarshal(raw, &one); err == nil {
+		return []keyNode{one}
+	}
+	var many []json.RawMessage
+	if err := json.Unmarshal(raw, &many); err != nil {
+		return nil
+	}
+	res := make([]keyNode, 0, len(many))
+	for _, m := range many {
+		var n keyNode
+		if err := json.Unmarshal(m, &n); err == nil {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// lists checks if the keyID key is in the "publicKey" or "assertionMethod" properties of the n document,
+// either embedded, or as a bare IRI
+func (n keyNode) lists(keyID vocab.IRI) bool {
+	for _, raw := range []json.RawMessage{n.PublicKey, n.AssertionMethod} {
+		for _, kn := range nodes(raw) {
+			if kn.ID == keyID {
+				return true
+			}
+		}
+		var iris []string
+		if err := json.Unmarshal(raw, &iris); err != nil {
+			var iri string
+			if err = json.Unmarshal(raw, &iri); err == nil {
+				iris = append(iris, iri)
+			}
+		}
+		for _, iri := range iris {
+			if vocab.IRI(iri) == keyID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadKey loads the doc document and looks for the keyID key in it
+func (c C) loadKey(ctx context.Context, keyID, doc vocab.IRI) (*ResolvedKey, error) {
+	d, err := c.flight.do(ctx, doc, c.fetch)
+	if err != nil {
+		return nil, errf("Unable to load key").iri(keyID).annotate(err)
+	}
+	var root keyNode
+	if err = json.Unmarshal(d.body, &root); err != nil {
+		return nil, errf("Unable to parse key document").iri(keyID).annotate(err)
+	}
+
+	k := ResolvedKey{ID: keyID}
+	var node *keyNode
+	if root.ID == keyID && (len(root.PublicKeyPem) > 0 || len(root.PublicKeyMultibase) > 0) {
+		// NOTE(marius): standalone key document
+		node = &root
+		k.Owner = root.Owner
+		if len(k.Owner) == 0 {
+			k.Owner = root.Controller
+		}
+	} else {
+		for _, n := range append(nodes(root.PublicKey), nodes(root.AssertionMethod)...) {
+			if n.ID == keyID {
+				n := n
+				node = &n
+				break
+			}
+		}
+		k.Owner = root.ID
+		if node != nil && (len(node.Owner) > 0 && node.Owner != root.ID || len(node.Controller) > 0 && node.Controller != root.ID) {
+			return nil, errf("Key is not owned by the actor it's embedded in").iri(keyID)
+		}
+	}
+	if node == nil {
+		return nil, errf("Unable to find key in document %s", doc).iri(keyID)
+	}
+	if len(k.Owner) == 0 {
+		return nil, errf("Key doesn't have an owner").iri(keyID)
+	}
+	if !sameOrigin(k.Owner, keyID) {
+		return nil, errf("Key owner %s belongs to a different origin", k.Owner).iri(keyID)
+	}
+
+	switch {
+	case len(node.PublicKeyPem) > 0:
+		k.Key, err = parsePublicKeyPem(node.PublicKeyPem)
+	case len(node.PublicKeyMultibase) > 0:
+		k.Key, err = parseMultibaseKey(node.PublicKeyMultibase)
+	default:
+		err = errors.Newf("missing key material")
+	}
+	if err != nil {
+		return nil, errf("Unable to parse public key").iri(keyID).annotate(err)
+	}
+
+	body := d.body
+	if k.Owner != root.ID {
+		// NOTE(marius): a standalone key can name any actor as its owner, so we check that the owner lists it
+		owner, err := c.flight.do(ctx, k.Owner, c.fetch)
+		if err != nil {
+			return nil, errf("Unable to load key owner %s", k.Owner).iri(keyID).annotate(err)
+		}
+		var on keyNode
+		if err = json.Unmarshal(owner.body, &on); err != nil || on.ID != k.Owner || !on.lists(keyID) {
+			return nil, errf("Key owner %s doesn't list the key", k.Owner).iri(keyID)
+		}
+		body = owner.body
+	}
+	if it, err := vocab.UnmarshalJSON(body); err == nil && vocab.ActorTypes.Contains(it.GetType()) {
+		k.actor, _ = vocab.ToActor(it)
+	}
+	return &k, nil
+}
+
+func sameOrigin(a, b vocab.IRI) bool {
+	return originOf(a.String()) == originOf(b.String())
+}
+
+// parseMultibaseKey decodes a FEP-521a publicKeyMultibase value, which is a base58-btc encoded,
+// multicodec prefixed, Ed25519 or RSA public key.
+func parseMultibaseKey(s string) (crypto.PublicKey, error) {
+	if len(s) == 0 || s[0] != 'z' {
+		return nil, errors.Newf("unsupported multibase encoding")
+	}
+	raw, err := base58Decode(s[1:])
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(raw) == 2+ed25519.PublicKeySize && raw[0] == 0xed && raw[1] == 0x01:
+		return ed25519.PublicKey(raw[2:]), nil
+	case len(raw) > 2 && raw[0] == 0x85 && raw[1] == 0x24:
+		return x509.ParsePKCS1PublicKey(raw[2:])
+	}
+	return nil, errors.Newf("unsupported multicodec key type")
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Decode(s string) ([]byte, error) {
+	res := make([]byte, 0, len(s))
+	for _, ch := range []byte(s) {
+		carry := -1
+		for i := 0; i < len(base58Alphabet); i++ {
+			if base58Alphabet[i] == ch {
+				carry = i
+				break
+			}
+		}
+		if carry < 0 {
+			return nil, errors.Newf("invalid base58 character %q", ch)
+		}
+		for i := len(res) - 1; i >= 0; i-- {
+			carry += int(res[i]) * 58
+			res[i] = byte(carry)
+			carry >>= 8
+		}
+		for ; carry > 0; carry >>= 8 {
+			res = append([]byte{byte(carry)}, res...)
+		}
+	}
+	for _, ch := range []byte(s) {
+		if ch != base58Alphabet[0] {
+			break
+		}
+		res = append([]byte{0}, res...)
+	}
+	return res, nil
+}
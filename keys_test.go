@@ -0,0 +1,118 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func base58Encode(b []byte) string {
+	n := new(big.Int).SetBytes(b)
+	res := make([]byte, 0)
+	for mod := new(big.Int); n.Sign() > 0; {
+		n.DivMod(n, big.NewInt(58), mod)
+		res = append([]byte{base58Alphabet[mod.Int64()]}, res...)
+	}
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		res = append([]byte{'1'}, res...)
+	}
+	return string(res)
+}
+
+func pemKey(k ed25519.PrivateKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(k.Public())
+	return strings.ReplaceAll(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), "\n", `\n`)
+}
+
+func TestKeyResolver_Resolve(t *testing.T) {
+	multibase := "z" + base58Encode(append([]byte{0xed, 0x01}, testEd25519Key.Public().(ed25519.PublicKey)...))
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/actor":
+			w.Write([]byte(`{"id": "` + srv.URL + `/actor", "type": "Person",
+				"publicKey": {"id": "` + srv.URL + `/actor#main-key", "owner": "` + srv.URL + `/actor", "publicKeyPem": "` + pemKey(testEd25519Key) + `"},
+				"assertionMethod": [{"id": "` + srv.URL + `/actor#ed25519-key", "type": "Multikey", "controller": "` + srv.URL + `/actor", "publicKeyMultibase": "` + multibase + `"}, "` + srv.URL + `/key"]}`))
+		case "/key":
+			w.Write([]byte(`{"id": "` + srv.URL + `/key", "type": "Key", "owner": "` + srv.URL + `/actor", "publicKeyPem": "` + pemKey(testEd25519Key) + `"}`))
+		case "/unlisted-key":
+			w.Write([]byte(`{"id": "` + srv.URL + `/unlisted-key", "type": "Key", "owner": "` + srv.URL + `/actor", "publicKeyPem": "` + pemKey(testEd25519Key) + `"}`))
+		case "/spoofed-key":
+			w.Write([]byte(`{"id": "` + srv.URL + `/spoofed-key", "type": "Key", "owner": "https://example.com/actor", "publicKeyPem": "` + pemKey(testEd25519Key) + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	r := NewKeyResolver(New(), time.Minute)
+	for _, id := range []string{"/actor#main-key", "/actor#ed25519-key", "/key"} {
+		t.Run(id, func(t *testing.T) {
+			k, err := r.Resolve(context.Background(), vocab.IRI(srv.URL+id))
+			if err != nil {
+				t.Fatalf("Resolve() error = %s", err)
+			}
+			if k.Owner != vocab.IRI(srv.URL+"/actor") || !testEd25519Key.Public().(ed25519.PublicKey).Equal(k.Key) {
+				t.Errorf("Resolve() = %v, expected the test key owned by the actor", k)
+			}
+		})
+	}
+	for _, id := range []string{"/actor#missing-key", "/unlisted-key", "/spoofed-key", "/missing"} {
+		t.Run(id, func(t *testing.T) {
+			if k, err := r.Resolve(context.Background(), vocab.IRI(srv.URL+id)); err == nil {
+				t.Errorf("Resolve() = %v, expected an error", k)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier_keyRotation(t *testing.T) {
+	key := testEd25519Key
+	fetches := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Write([]byte(`{"id": "` + srv.URL + `/actor", "type": "Person",
+			"publicKey": {"id": "` + srv.URL + `/actor#main-key", "owner": "` + srv.URL + `/actor", "publicKeyPem": "` + pemKey(key) + `"}}`))
+	}))
+	defer srv.Close()
+
+	c := New(WithCache(NewMemCache()))
+	v := SignatureVerifier{Client: c, Keys: NewKeyResolver(c, time.Hour)}
+	verify := func(k ed25519.PrivateKey) error {
+		req, _ := http.NewRequest(http.MethodPost, "https://example.com/inbox", bytes.NewReader([]byte(`{}`)))
+		CavageSigner{KeyID: srv.URL + "/actor#main-key", Key: k}.Sign(req)
+		_, err := v.Verify(req)
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := verify(key); err != nil {
+			t.Fatalf("Verify() error = %s", err)
+		}
+	}
+	if fetches != 1 {
+		t.Errorf("Key was fetched %d times, expected it to be cached", fetches)
+	}
+
+	key = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{0x43}, ed25519.SeedSize))
+	if err := verify(key); err != nil {
+		t.Fatalf("Verify() error = %s, expected the rotated key to be fetched again", err)
+	}
+	if fetches != 2 {
+		t.Errorf("Key was fetched %d times, expected it to be fetched again after the rotation", fetches)
+	}
+}
@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-ap/errors"
+	vocab "github.com/mix/activitypub"
+)
+
+// TypeMismatchError is returned when the item loaded from an IRI is not of the type the caller expected
+type TypeMismatchError struct {
+	IRI      vocab.IRI
+	Expected string
+	Got      vocab.ActivityVocabularyType
+}
+
+// Error returns the formatted error
+func (e TypeMismatchError) Error() string {
+	got := string(e.Got)
+	if got == "" {
+		got = "untyped item"
+	}
+	return fmt.Sprintf("invalid type %s for %s, expected %s", got, e.IRI, e.Expected)
+}
+
+// IsTypeMismatch returns true if the err error was caused by loading an item of an unexpected type
+func IsTypeMismatch(err error) bool {
+	return errors.As(err, new(TypeMismatchError))
+}
+
+// Load dereferences the iri IRI using the c client and returns the resulting item as a T,
+// which can be any of the concrete types of the vocabulary: *vocab.Actor, *vocab.Question, *vocab.Place, etc.
+// If the type of the loaded item doesn't match T, it returns a TypeMismatchError.
+//
+// Loading a deleted object as a *vocab.Tombstone doesn't return an error.
+func Load[T vocab.Item](ctx context.Context, c Basic, iri vocab.IRI) (T, error) {
+	var zero T
+	it, err := c.CtxLoadIRI(ctx, iri)
+	if err != nil {
+		if _, ok := any(zero).(*vocab.Tombstone); ok && IsGone(err) && !vocab.IsNil(it) {
+			return as[T](iri, it)
+		}
+		return zero, err
+	}
+	return as[T](iri, it)
+}
+
+// as validates that the it item has a type compatible with T and converts it.
+func as[T vocab.Item](iri vocab.IRI, it vocab.Item) (T, error) {
+	var zero T
+	if vocab.IsNil(it) {
+		return zero, errf("Unable to load IRI, nil item").iri(iri)
+	}
+	typ := it.GetType()
+	if types := expectedTypes(zero); len(types) > 0 {
+		if !types.Contains(typ) {
+			return zero, TypeMismatchError{IRI: iri, Expected: typesString(types), Got: typ}
+		}
+	} else if !it.IsObject() {
+		return zero, TypeMismatchError{IRI: iri, Expected: "an Object", Got: typ}
+	}
+	if t, ok := it.(T); ok {
+		return t, nil
+	}
+
+	// NOTE(marius): the vocab package uses the same structs for multiple types, eg: *vocab.Object for both
+	// Notes and Articles, so after validating the type, we convert the item to the structure we need.
+	var res vocab.Item
+	var err error
+	switch any(zero).(type) {
+	case *vocab.Object:
+		res, err = vocab.ToObject(it)
+	case *vocab.Actor:
+		res, err = vocab.ToActor(it)
+	case *vocab.Activity:
+		res, err = vocab.ToActivity(it)
+	case *vocab.IntransitiveActivity:
+		res, err = vocab.ToIntransitiveActivity(it)
+	case *vocab.Question:
+		res, err = vocab.ToQuestion(it)
+	case *vocab.Tombstone:
+		res, err = vocab.ToTombstone(it)
+	case *vocab.Place:
+		res, err = vocab.ToPlace(it)
+	case *vocab.Profile:
+		res, err = vocab.ToProfile(it)
+	case *vocab.Relationship:
+		res, err = vocab.ToRelationship(it)
+	case *vocab.Link:
+		res, err = vocab.ToLink(it)
+	case *vocab.Collection:
+		res, err = vocab.ToCollection(it)
+	case *vocab.CollectionPage:
+		res, err = vocab.ToCollectionPage(it)
+	case *vocab.OrderedCollection:
+		res, err = vocab.ToOrderedCollection(it)
+	case *vocab.OrderedCollectionPage:
+		res, err = vocab.ToOrderedCollectionPage(it)
+	}
+	t, ok := res.(T)
+	if err != nil || !ok {
+		return zero, TypeMismatchError{IRI: iri, Expected: fmt.Sprintf("%T", zero), Got: typ}
+	}
+	return t, nil
+}
+
+// expectedTypes returns the vocabulary types that can be loaded into the type of v.
+// An empty result means that any object type is accepted.
+func expectedTypes(v any) vocab.ActivityVocabularyTypes {
+	switch v.(type) {
+	case *vocab.Actor:
+		return append(vocab.ActivityVocabularyTypes{vocab.ActorType}, vocab.ActorTypes...)
+	case *vocab.Activity:
+		return append(vocab.ActivityVocabularyTypes{vocab.ActivityType}, vocab.ActivityTypes...)
+	case *vocab.IntransitiveActivity:
+		return append(vocab.ActivityVocabularyTypes{vocab.IntransitiveActivityType}, vocab.IntransitiveActivityTypes...)
+	case *vocab.Question:
+		return vocab.ActivityVocabularyTypes{vocab.QuestionType}
+	case *vocab.Tombstone:
+		return vocab.ActivityVocabularyTypes{vocab.TombstoneType}
+	case *vocab.Place:
+		return vocab.ActivityVocabularyTypes{vocab.PlaceType}
+	case *vocab.Profile:
+		return vocab.ActivityVocabularyTypes{vocab.ProfileType}
+	case *vocab.Relationship:
+		return vocab.ActivityVocabularyTypes{vocab.RelationshipType}
+	case *vocab.Link:
+		return vocab.LinkTypes
+	case *vocab.Collection:
+		return vocab.ActivityVocabularyTypes{vocab.CollectionType}
+	case *vocab.CollectionPage:
+		return vocab.ActivityVocabularyTypes{vocab.CollectionPageType}
+	case *vocab.OrderedCollection:
+		return vocab.ActivityVocabularyTypes{vocab.OrderedCollectionType}
+	case *vocab.OrderedCollectionPage:
+		return vocab.ActivityVocabularyTypes{vocab.OrderedCollectionPageType}
+	}
+	return nil
+}
+
+func typesString(types vocab.ActivityVocabularyTypes) string {
+	s := make([]string, 0, len(types))
+	for _, typ := range types {
+		s = append(s, string(typ))
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestLoad(t *testing.T) {
+	docs := map[string]string{
+		"/question": `{"id": "https://example.com/question", "type": "Question", "oneOf": [{"type": "Note", "name": "yes"}]}`,
+		"/note":     `{"id": "https://example.com/note", "type": "Note"}`,
+		"/person":   `{"id": "https://example.com/person", "type": "Person"}`,
+		"/place":    `{"id": "https://example.com/place", "type": "Place", "latitude": 44.4}`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		w.Write([]byte(doc))
+	}))
+	defer srv.Close()
+	base := vocab.IRI(srv.URL)
+	ctx := context.Background()
+	c := New()
+
+	q, err := Load[*vocab.Question](ctx, c, base.AddPath("question"))
+	if err != nil || q.GetLink() != "https://example.com/question" {
+		t.Errorf("Load[*vocab.Question]() = %v, %v", q, err)
+	}
+	p, err := Load[*vocab.Place](ctx, c, base.AddPath("place"))
+	if err != nil || p.Latitude != 44.4 {
+		t.Errorf("Load[*vocab.Place]() = %v, %v", p, err)
+	}
+	ts, err := Load[*vocab.Tombstone](ctx, c, base.AddPath("deleted"))
+	if err != nil || ts.GetType() != vocab.TombstoneType {
+		t.Errorf("Load[*vocab.Tombstone]() = %v, %v, expected a Tombstone for a deleted object", ts, err)
+	}
+	if _, err = Load[*vocab.Question](ctx, c, base.AddPath("note")); !IsTypeMismatch(err) {
+		t.Errorf("Load[*vocab.Question]() error = %v, expected a type mismatch for a Note", err)
+	}
+
+	if a, err := c.Actor(ctx, base.AddPath("note")); a != nil || !IsTypeMismatch(err) {
+		t.Errorf("Actor() = %v, %v, expected a type mismatch for a Note", a, err)
+	}
+	if a, err := c.Activity(ctx, base.AddPath("person")); a != nil || !IsTypeMismatch(err) {
+		t.Errorf("Activity() = %v, %v, expected a type mismatch for a Person", a, err)
+	}
+	if a, err := c.Actor(ctx, base.AddPath("person")); err != nil || a.GetType() != vocab.PersonType {
+		t.Errorf("Actor() = %v, %v", a, err)
+	}
+	if o, err := c.Object(ctx, base.AddPath("note")); err != nil || o.GetType() != vocab.NoteType {
+		t.Errorf("Object() = %v, %v", o, err)
+	}
+}
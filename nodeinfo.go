@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+const (
+	// NodeInfoSchema20 is the relation of the links to NodeInfo documents in the 2.0 version of the schema
+	NodeInfoSchema20 = "http://nodeinfo.diaspora.software/ns/schema/2.0"
+	// NodeInfoSchema21 is the relation of the links to NodeInfo documents in the 2.1 version of the schema
+	NodeInfoSchema21 = "http://nodeinfo.diaspora.software/ns/schema/2.1"
+)
+
+// nodeInfoSchemas are the supported NodeInfo schema versions, in the order of preference
+var nodeInfoSchemas = []string{NodeInfoSchema21, NodeInfoSchema20}
+
+// NodeInfo is the metadata a server publishes about itself, as described by the NodeInfo protocol
+//
+// https://nodeinfo.diaspora.software/protocol
+type NodeInfo struct {
+	Version           string           `json:"version"`
+	Software          NodeInfoSoftware `json:"software"`
+	Protocols         []string         `json:"protocols"`
+	Services          NodeInfoServices `json:"services"`
+	OpenRegistrations bool             `json:"openRegistrations"`
+	Usage             NodeInfoUsage    `json:"usage"`
+	Metadata          map[string]any   `json:"metadata,omitempty"`
+}
+
+// NodeInfoSoftware describes the software a server is running
+type NodeInfoSoftware struct {
+	// Name is the canonical name of the software, in lower case, like "mastodon" or "fedbox"
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	Repository string `json:"repository,omitempty"`
+	Homepage   string `json:"homepage,omitempty"`
+}
+
+// NodeInfoServices lists the third party sites a server can retrieve messages from, or publish messages to
+type NodeInfoServices struct {
+	Inbound  []string `json:"inbound"`
+	Outbound []string `json:"outbound"`
+}
+
+// NodeInfoUsage holds the usage statistics of a server
+type NodeInfoUsage struct {
+	Users         NodeInfoUsers `json:"users"`
+	LocalPosts    int64         `json:"localPosts,omitempty"`
+	LocalComments int64         `json:"localComments,omitempty"`
+}
+
+// NodeInfoUsers holds the user statistics of a server
+type NodeInfoUsers struct {
+	Total          int64 `json:"total,omitempty"`
+	ActiveHalfyear int64 `json:"activeHalfyear,omitempty"`
+	ActiveMonth    int64 `json:"activeMonth,omitempty"`
+}
+
+// SupportsProtocol returns true if the server supports the protocol, like "activitypub"
+func (n NodeInfo) SupportsProtocol(protocol string) bool {
+	for _, p := range n.Protocols {
+		if strings.EqualFold(p, protocol) {
+			return true
+		}
+	}
+	return false
+}
+
+func acceptJSON(r *http.Request) {
+	r.Header.Set("Accept", "application/json")
+}
+
+// NodeInfo discovers the NodeInfo document of host, using its /.well-known/nodeinfo end-point,
+// and loads the highest version of the schema we support: 2.1 or 2.0.
+func (c C) NodeInfo(ctx context.Context, host string) (*NodeInfo, error) {
+	wk := "https://" + host + "/.well-known/nodeinfo"
+	body, err := c.wellKnown(ctx, wk, acceptJSON)
+	if err != nil {
+		return nil, err
+	}
+	links := JRD{}
+	if err = json.Unmarshal(body, &links); err != nil {
+		return nil, errf("Unable to parse NodeInfo discovery document %s", wk).annotate(err)
+	}
+
+	var href string
+	for _, schema := range nodeInfoSchemas {
+		if l := links.Link(schema, ""); l != nil && len(l.Href) > 0 {
+			href = l.Href
+			break
+		}
+	}
+	if len(href) == 0 {
+		return nil, errf("Unable to find a supported NodeInfo schema for %s", host)
+	}
+	if body, err = c.wellKnown(ctx, href, acceptJSON); err != nil {
+		return nil, err
+	}
+	ni := new(NodeInfo)
+	if err = json.Unmarshal(body, ni); err != nil {
+		return nil, errf("Unable to parse NodeInfo document %s", href).annotate(err)
+	}
+	ni.Software.Name = strings.ToLower(ni.Software.Name)
+	return ni, nil
+}
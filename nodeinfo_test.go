@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// insecureClient returns a client for the srv TLS server, which doesn't validate the certificates,
+// so the server can be reached using other host names than 127.0.0.1, like localhost.
+func insecureClient(srv *httptest.Server) *http.Client {
+	tr := srv.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &http.Client{Transport: tr}
+}
+
+func TestC_NodeInfo(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/nodeinfo":
+			w.Write([]byte(`{"links": [
+				{"rel": "http://nodeinfo.diaspora.software/ns/schema/1.0", "href": "` + srv.URL + `/nodeinfo/1.0"},
+				{"rel": "http://nodeinfo.diaspora.software/ns/schema/2.0", "href": "` + srv.URL + `/nodeinfo/2.0"},
+				{"rel": "http://nodeinfo.diaspora.software/ns/schema/2.1", "href": "` + srv.URL + `/nodeinfo/2.1"}]}`))
+		case "/nodeinfo/2.1":
+			w.Write([]byte(`{"version": "2.1", "software": {"name": "Mastodon", "version": "4.2.1", "repository": "https://github.com/mastodon/mastodon"},
+				"protocols": ["activitypub"], "services": {"inbound": [], "outbound": []}, "openRegistrations": true,
+				"usage": {"users": {"total": 42, "activeMonth": 10, "activeHalfyear": 20}, "localPosts": 1000}, "metadata": {"nodeName": "test"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(WithHTTPClient(insecureClient(srv)))
+
+	ni, err := c.NodeInfo(context.Background(), strings.TrimPrefix(srv.URL, "https://"))
+	if err != nil {
+		t.Fatalf("NodeInfo() error = %s", err)
+	}
+	if ni.Version != "2.1" || ni.Software.Name != "mastodon" || ni.Software.Version != "4.2.1" {
+		t.Errorf("NodeInfo() = %+v, expected the 2.1 document of a mastodon server", ni)
+	}
+	if !ni.SupportsProtocol("activitypub") || !ni.OpenRegistrations || ni.Usage.Users.Total != 42 || ni.Usage.LocalPosts != 1000 {
+		t.Errorf("NodeInfo() = %+v", ni)
+	}
+
+	if _, err = c.NodeInfo(context.Background(), "127.0.0.1:1"); err == nil {
+		t.Errorf("NodeInfo() should have failed for an unreachable host")
+	}
+}
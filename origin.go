@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	vocab "github.com/mix/activitypub"
+)
+
+// maxVerifyDepth is the maximum number of nested loads triggered by the verification of a single object
+const maxVerifyDepth = 2
+
+// WithOriginVerification enables checking that the objects loaded by the client really belong
+// to the origin (scheme and host) that served them, after following any redirects:
+//
+//   - when the id of an object points to a different origin, it gets loaded again from its id,
+//     and the result of that load is returned instead.
+//   - when an object embeds other objects whose ids point to a different origin,
+//     the embedded objects are replaced with the versions loaded from their own origin,
+//     or with their bare IRIs if that fails.
+func WithOriginVerification() OptionFn {
+	return func(c *C) error {
+		c.verifyOrigin = true
+		return nil
+	}
+}
+
+// verify checks that the it item, loaded from the id IRI, has an id belonging to the origin it was served from.
+func (c C) verify(ctx context.Context, id vocab.IRI, doc document, it vocab.Item, depth int) (vocab.Item, error) {
+	src := originOf(doc.url)
+	itID := it.GetLink()
+	if len(itID) > 0 && originOf(itID.String()) != src {
+		if itID == id || depth >= maxVerifyDepth {
+			return nil, errf("Object id %s doesn't match the origin it was loaded from %s", itID, src).iri(id)
+		}
+		// NOTE(marius): the document claims to be from another origin, so we load it from there
+		c.infoFn(Ctx{"IRI": id, "id": itID, "origin": src})("Object id doesn't match its origin, loading it from its id")
+		return c.load(ctx, itID, depth+1)
+	}
+	c.verifyEmbedded(ctx, src, it, depth)
+	return it, nil
+}
+
+// verifyEmbedded replaces the objects embedded in it, that have ids belonging to a different origin than src,
+// with the versions loaded from their own origin, or with their IRIs, if they can't be loaded.
+func (c C) verifyEmbedded(ctx context.Context, src string, it vocab.Item, depth int) {
+	for _, p := range embeddedProps(it) {
+		ob := p.get()
+		if vocab.IsNil(ob) || !ob.IsObject() {
+			continue
+		}
+		obID := ob.GetLink()
+		if len(obID) == 0 || originOf(obID.String()) == src {
+			if depth < maxVerifyDepth {
+				c.verifyEmbedded(ctx, src, ob, depth+1)
+			}
+			continue
+		}
+		if depth >= maxVerifyDepth {
+			p.set(obID)
+			continue
+		}
+		verified, err := c.load(ctx, obID, depth+1)
+		if err != nil || vocab.IsNil(verified) {
+			c.errFn(Ctx{"IRI": obID, "origin": src})("Unable to verify embedded object: %v", err)
+			verified = obID
+		}
+		p.set(verified)
+	}
+}
+
+// embeddedProp allows reading and replacing a property of an object that can contain embedded objects
+type embeddedProp struct {
+	get func() vocab.Item
+	set func(vocab.Item)
+}
+
+func embeddedProps(it vocab.Item) []embeddedProp {
+	props := make([]embeddedProp, 0)
+	switch i := it.(type) {
+	case *vocab.Activity:
+		props = append(props,
+			embeddedProp{get: func() vocab.Item { return i.Actor }, set: func(v vocab.Item) { i.Actor = v }},
+			embeddedProp{get: func() vocab.Item { return i.Object }, set: func(v vocab.Item) { i.Object = v }},
+			embeddedProp{get: func() vocab.Item { return i.Target }, set: func(v vocab.Item) { i.Target = v }},
+			embeddedProp{get: func() vocab.Item { return i.Origin }, set: func(v vocab.Item) { i.Origin = v }},
+			embeddedProp{get: func() vocab.Item { return i.Result }, set: func(v vocab.Item) { i.Result = v }},
+			embeddedProp{get: func() vocab.Item { return i.Instrument }, set: func(v vocab.Item) { i.Instrument = v }},
+		)
+	case *vocab.IntransitiveActivity:
+		props = append(props,
+			embeddedProp{get: func() vocab.Item { return i.Actor }, set: func(v vocab.Item) { i.Actor = v }},
+			embeddedProp{get: func() vocab.Item { return i.Target }, set: func(v vocab.Item) { i.Target = v }},
+			embeddedProp{get: func() vocab.Item { return i.Origin }, set: func(v vocab.Item) { i.Origin = v }},
+			embeddedProp{get: func() vocab.Item { return i.Result }, set: func(v vocab.Item) { i.Result = v }},
+			embeddedProp{get: func() vocab.Item { return i.Instrument }, set: func(v vocab.Item) { i.Instrument = v }},
+		)
+	case *vocab.Question:
+		props = append(props,
+			embeddedProp{get: func() vocab.Item { return i.Actor }, set: func(v vocab.Item) { i.Actor = v }},
+			embeddedProp{get: func() vocab.Item { return i.Target }, set: func(v vocab.Item) { i.Target = v }},
+			embeddedProp{get: func() vocab.Item { return i.Origin }, set: func(v vocab.Item) { i.Origin = v }},
+			embeddedProp{get: func() vocab.Item { return i.Result }, set: func(v vocab.Item) { i.Result = v }},
+			embeddedProp{get: func() vocab.Item { return i.Instrument }, set: func(v vocab.Item) { i.Instrument = v }},
+		)
+	case vocab.CollectionInterface:
+		props = append(props, itemsProps(i.Collection())...)
+	}
+	if _, ok := it.(vocab.CollectionInterface); !ok {
+		props = append(props, objectProps(it)...)
+	}
+
+	// NOTE(marius): properties can contain multiple values, we verify each of them separately
+	expanded := make([]embeddedProp, 0, len(props))
+	for _, p := range props {
+		if col, ok := p.get().(vocab.ItemCollection); ok {
+			expanded = append(expanded, itemsProps(col)...)
+			continue
+		}
+		expanded = append(expanded, p)
+	}
+	return expanded
+}
+
+// objectProps returns the properties, common to all objects, activities and actors, that can embed
+// objects from other origins
+func objectProps(it vocab.Item) []embeddedProp {
+	props := make([]embeddedProp, 0)
+	vocab.OnObject(it, func(o *vocab.Object) error {
+		props = append(props,
+			embeddedProp{get: func() vocab.Item { return o.AttributedTo }, set: func(v vocab.Item) { o.AttributedTo = v }},
+			embeddedProp{get: func() vocab.Item { return o.InReplyTo }, set: func(v vocab.Item) { o.InReplyTo = v }},
+			embeddedProp{get: func() vocab.Item { return o.Attachment }, set: func(v vocab.Item) { o.Attachment = v }},
+			embeddedProp{get: func() vocab.Item { return o.Context }, set: func(v vocab.Item) { o.Context = v }},
+		)
+		props = append(props, itemsProps(o.Tag)...)
+		return nil
+	})
+	return props
+}
+
+func itemsProps(col vocab.ItemCollection) []embeddedProp {
+	props := make([]embeddedProp, 0, len(col))
+	for k := range col {
+		k := k
+		props = append(props, embeddedProp{get: func() vocab.Item { return col[k] }, set: func(v vocab.Item) { col[k] = v }})
+	}
+	return props
+}
+
+// originOf returns the scheme and host of the u URL
+func originOf(u string) string {
+	uu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(uu.Scheme + "://" + uu.Host)
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestWithOriginVerification(t *testing.T) {
+	var a, b *httptest.Server
+	b = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/note":
+			w.Write([]byte(`{"id": "` + b.URL + `/note", "type": "Note", "content": "real"}`))
+		case "/redirected":
+			w.Write([]byte(`{"id": "` + a.URL + `/redirect", "type": "Note"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer b.Close()
+	a = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/spoof":
+			w.Write([]byte(`{"id": "` + b.URL + `/note", "type": "Note", "content": "forged"}`))
+		case "/redirect":
+			http.Redirect(w, r, b.URL+"/redirected", http.StatusFound)
+		case "/reply":
+			w.Write([]byte(`{"id": "` + a.URL + `/reply", "type": "Note",
+				"attributedTo": {"id": "` + b.URL + `/users/bob", "type": "Person", "name": "forged"},
+				"tag": [{"id": "` + b.URL + `/note", "type": "Note", "content": "forged"}]}`))
+		case "/create":
+			w.Write([]byte(`{"id": "` + a.URL + `/create", "type": "Create", "actor": "` + a.URL + `/actor",
+				"object": [{"id": "` + b.URL + `/note", "type": "Note", "content": "forged"}, {"id": "` + b.URL + `/missing", "type": "Note"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer a.Close()
+
+	ctx := context.Background()
+	c := New(WithOriginVerification())
+
+	it, err := c.CtxLoadIRI(ctx, vocab.IRI(a.URL+"/spoof"))
+	if err != nil {
+		t.Fatalf("CtxLoadIRI() error = %s", err)
+	}
+	if ob, _ := vocab.ToObject(it); ob == nil || ob.Content.First().Value.String() != "real" {
+		t.Errorf("CtxLoadIRI() = %v, expected the object loaded from its own origin", it)
+	}
+
+	if it, err = c.CtxLoadIRI(ctx, vocab.IRI(a.URL+"/redirect")); err == nil {
+		t.Errorf("CtxLoadIRI() = %v, expected an error for an object served from a different origin than its id", it)
+	}
+
+	it, err = c.CtxLoadIRI(ctx, vocab.IRI(a.URL+"/create"))
+	if err != nil {
+		t.Fatalf("CtxLoadIRI() error = %s", err)
+	}
+	act, err := vocab.ToActivity(it)
+	if err != nil {
+		t.Fatalf("ToActivity() error = %s", err)
+	}
+	col, ok := act.Object.(vocab.ItemCollection)
+	if !ok || len(col) != 2 {
+		t.Fatalf("Activity object = %v, expected two items", act.Object)
+	}
+	if ob, _ := vocab.ToObject(col[0]); ob == nil || ob.Content.First().Value.String() != "real" {
+		t.Errorf("Embedded object = %v, expected the object loaded from its own origin", col[0])
+	}
+	if !col[1].IsLink() || col[1].GetLink() != vocab.IRI(b.URL+"/missing") {
+		t.Errorf("Embedded object = %v, expected an unverifiable object to be replaced by its IRI", col[1])
+	}
+
+	it, err = c.CtxLoadIRI(ctx, vocab.IRI(a.URL+"/reply"))
+	if err != nil {
+		t.Fatalf("CtxLoadIRI() error = %s", err)
+	}
+	reply, err := vocab.ToObject(it)
+	if err != nil {
+		t.Fatalf("ToObject() error = %s", err)
+	}
+	if vocab.IsNil(reply.AttributedTo) || !reply.AttributedTo.IsLink() || reply.AttributedTo.GetLink() != vocab.IRI(b.URL+"/users/bob") {
+		t.Errorf("attributedTo = %v, expected the unverifiable actor to be replaced by its IRI", reply.AttributedTo)
+	}
+	if len(reply.Tag) != 1 {
+		t.Fatalf("tag = %v, expected one item", reply.Tag)
+	}
+	if ob, _ := vocab.ToObject(reply.Tag[0]); ob == nil || ob.Content.First().Value.String() != "real" {
+		t.Errorf("tag = %v, expected the object loaded from its own origin", reply.Tag[0])
+	}
+
+	c = New()
+	if it, _ = c.CtxLoadIRI(ctx, vocab.IRI(a.URL+"/spoof")); it.GetLink() != vocab.IRI(b.URL+"/note") {
+		t.Errorf("CtxLoadIRI() = %v, expected the object as served, without verification", it)
+	}
+}
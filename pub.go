@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/go-ap/errors"
 	vocab "github.com/mix/activitypub"
@@ -105,48 +106,97 @@ func (c C) Collection(ctx context.Context, i vocab.IRI, filters ...FilterFn) (vo
 	return c.collection(ctx, iri(i, filters...))
 }
 
-// Actor
+// CollectionAt loads the collection page the cur Cursor points to, without the items that were already consumed.
+// The following pages can be loaded from its "next" link, or from its "prev" link for reverse cursors.
+func (c C) CollectionAt(ctx context.Context, cur Cursor) (vocab.CollectionInterface, error) {
+	it := c.Resume(ctx, cur)
+	for it.NextPage() {
+		if it.pos < len(it.items) || vocab.IsNil(it.next) {
+			break
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, errors.Annotatef(err, "Unable to load cursor page: %s", cur.Page)
+	}
+	if it.page == nil {
+		return nil, errors.Newf("Unable to load cursor page: %s", cur.Page)
+	}
+	rest := it.items[it.pos:]
+	if it.reverse {
+		rest = reversed(rest)
+	}
+	return withItems(it.page, rest), nil
+}
+
+// withItems returns a copy of the col collection, which contains the items
+func withItems(col vocab.CollectionInterface, items vocab.ItemCollection) vocab.CollectionInterface {
+	res, ok := shallowCopy(col).(vocab.CollectionInterface)
+	if !ok {
+		return col
+	}
+	switch cc := res.(type) {
+	case *vocab.OrderedCollectionPage:
+		cc.OrderedItems = items
+	case *vocab.OrderedCollection:
+		cc.OrderedItems = items
+	case *vocab.CollectionPage:
+		cc.Items = items
+	case *vocab.Collection:
+		cc.Items = items
+	}
+	return res
+}
+
+// Actor loads the Actor found at the iri IRI.
+// It returns a TypeMismatchError if the loaded item is not an Actor.
 func (c C) Actor(ctx context.Context, iri vocab.IRI) (*vocab.Actor, error) {
-	it, err := c.object(ctx, iri)
+	person, err := Load[*vocab.Actor](ctx, &c, iri)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Unable to load Actor: %s", iri)
 	}
-	var person *vocab.Actor
-	vocab.OnActor(it, func(p *vocab.Actor) error {
-		person = p
-		return nil
-	})
 	return person, nil
 }
 
-// Activity
+// Activity loads the Activity found at the iri IRI.
+// It returns a TypeMismatchError if the loaded item is not an Activity.
 func (c C) Activity(ctx context.Context, iri vocab.IRI) (*vocab.Activity, error) {
-	it, err := c.object(ctx, iri)
+	activity, err := Load[*vocab.Activity](ctx, &c, iri)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Unable to load Activity: %s", iri)
 	}
-	var activity *vocab.Activity
-	vocab.OnActivity(it, func(a *vocab.Activity) error {
-		activity = a
-		return nil
-	})
 	return activity, nil
 }
 
-// Object
+// Object loads the Object found at the iri IRI.
+// It returns a TypeMismatchError if the loaded item is not an Object, eg: a Link.
 func (c C) Object(ctx context.Context, iri vocab.IRI) (*vocab.Object, error) {
-	it, err := c.object(ctx, iri)
+	object, err := Load[*vocab.Object](ctx, &c, iri)
 	if err != nil {
 		return nil, errors.Annotatef(err, "Unable to load Object: %s", iri)
 	}
-	var object *vocab.Object
-	vocab.OnObject(it, func(o *vocab.Object) error {
-		object = o
-		return nil
-	})
 	return object, nil
 }
 
+// Handle returns the canonical "user@domain" handle of the act actor, using a WebFinger lookup for its
+// preferredUsername on its host. The WebFinger "self" link of the handle must point back to the actor,
+// which allows handles on a different domain than the actor's.
+// The handles are cached for a day.
+func (c C) Handle(ctx context.Context, act *vocab.Actor) (string, error) {
+	if act == nil || len(act.ID) == 0 {
+		return "", errors.Newf("Invalid actor, nil value")
+	}
+	now := time.Now()
+	if h, ok := c.handles.load(act.ID, now); ok {
+		return h, nil
+	}
+	h, err := c.handle(ctx, act)
+	if err != nil {
+		return "", err
+	}
+	c.handles.store(act.ID, h, now)
+	return h, nil
+}
+
 func validateIRIForRequest(i vocab.IRI) error {
 	u, err := i.URL()
 	if err != nil {
@@ -158,24 +208,33 @@ func validateIRIForRequest(i vocab.IRI) error {
 	return nil
 }
 
+// ToOutbox submits the a activity to the outbox of its actor.
+// Recipients belonging to domains not allowed by the domain policy of the client are removed from the submitted copy
+// of the activity, a is not modified.
 func (c C) ToOutbox(ctx context.Context, a vocab.Item) (vocab.IRI, vocab.Item, error) {
 	var iri vocab.IRI
 	vocab.OnActivity(a, func(a *vocab.Activity) error {
 		iri = outbox(a.Actor)
 		return nil
 	})
+	a = c.filterRecipients(a)
 	if err := validateIRIForRequest(iri); err != nil {
 		return "", nil, errors.Annotatef(err, "Invalid Outbox IRI")
 	}
 	return c.CtxToCollection(ctx, iri, a)
 }
 
+// ToInbox submits the a activity to the inbox of its actor.
+// Recipients belonging to domains not allowed by the domain policy of the client are removed from the submitted copy
+// of the activity, a is not modified.
+// For delivering the activity to the inboxes of its recipients, use Deliver.
 func (c C) ToInbox(ctx context.Context, a vocab.Item) (vocab.IRI, vocab.Item, error) {
 	var iri vocab.IRI
 	vocab.OnActivity(a, func(a *vocab.Activity) error {
 		iri = inbox(a.Actor)
 		return nil
 	})
+	a = c.filterRecipients(a)
 
 	if err := validateIRIForRequest(iri); err != nil {
 		return "", nil, errors.Annotatef(err, "Invalid Inbox IRI")
@@ -212,9 +271,6 @@ func (c C) collection(ctx context.Context, i vocab.IRI) (vocab.CollectionInterfa
 	}
 	return col, nil
 }
-func (c C) object(ctx context.Context, i vocab.IRI) (vocab.Item, error) {
-	return c.CtxLoadIRI(ctx, i)
-}
 
 func rawFilterQuery(f ...FilterFn) string {
 	if len(f) == 0 {
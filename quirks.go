@@ -0,0 +1,269 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+// AnySoftware is the software name for the quirk fixes that apply to documents from all servers
+const AnySoftware = "*"
+
+const (
+	// softwareTTL is the duration for which the software of a host, detected using NodeInfo, is cached
+	softwareTTL = 24 * time.Hour
+	// unknownSoftwareTTL is the duration for which we don't retry detecting the software of a host that failed
+	unknownSoftwareTTL = time.Hour
+)
+
+// QuirkFn rewrites, in place, a known deviation from the ActivityPub specification in the ob JSON object.
+// The fixes added with Quirks.Register are called for the loaded document, and for all the objects embedded in it,
+// the ones added with Quirks.RegisterDocument only for the loaded document.
+type QuirkFn func(ob map[string]any)
+
+// Quirks is a registry of fixes for the quirks of the ActivityPub documents returned by different
+// server software, keyed by the software names as reported by NodeInfo, like "mastodon" or "misskey".
+type Quirks struct {
+	m        sync.RWMutex
+	fixes    map[string][]QuirkFn
+	docFixes map[string][]QuirkFn
+	hosts    map[string]detectedSoftware
+}
+
+type detectedSoftware struct {
+	name    string
+	expires time.Time
+}
+
+// NewQuirks creates an empty Quirks registry.
+func NewQuirks() *Quirks {
+	return &Quirks{
+		fixes:    make(map[string][]QuirkFn),
+		docFixes: make(map[string][]QuirkFn),
+		hosts:    make(map[string]detectedSoftware),
+	}
+}
+
+// DefaultQuirks creates a Quirks registry with the fixes we know about:
+//
+//   - a missing "@context" is set to the ActivityStreams one, for all servers
+//   - single "attachment", "tag" and "url" values are converted to arrays, for all servers
+//   - missing "content", for objects that have a plain text or HTML "source", is filled from it, for all servers
+//   - Misskey, and its forks, "_misskey_content" is converted to a "source"
+//   - Pleroma, and Akkoma, string "source" values are converted to objects
+//
+// There are no Lemmy specific fixes, its documents get only the ones for all servers.
+func DefaultQuirks() *Quirks {
+	q := NewQuirks()
+	q.RegisterDocument(AnySoftware, defaultContext)
+	q.Register(AnySoftware, arrayProperties("attachment", "tag", "url"), contentFromSource)
+	q.Register("misskey", misskeyContent)
+	for _, fork := range []string{"calckey", "firefish", "foundkey", "iceshrimp", "sharkey", "cherrypick"} {
+		q.Register(fork, misskeyContent)
+	}
+	q.Register("pleroma", stringSource)
+	q.Register("akkoma", stringSource)
+	return q
+}
+
+// Register adds the fns fixes for the documents loaded from servers running software.
+// The AnySoftware name registers the fixes for all servers.
+func (q *Quirks) Register(software string, fns ...QuirkFn) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.fixes == nil {
+		q.fixes = make(map[string][]QuirkFn)
+	}
+	software = strings.ToLower(software)
+	q.fixes[software] = append(q.fixes[software], fns...)
+}
+
+// RegisterDocument adds the fns fixes for the top level documents loaded from servers running software,
+// they are not called for the objects embedded in them.
+// The AnySoftware name registers the fixes for all servers.
+func (q *Quirks) RegisterDocument(software string, fns ...QuirkFn) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	if q.docFixes == nil {
+		q.docFixes = make(map[string][]QuirkFn)
+	}
+	software = strings.ToLower(software)
+	q.docFixes[software] = append(q.docFixes[software], fns...)
+}
+
+// WithQuirks enables the normalization of the loaded documents, using the fixes in the q registry
+// that correspond to the software of the remote server, which is detected using NodeInfo.
+func WithQuirks(q *Quirks) OptionFn {
+	return func(c *C) error {
+		c.quirks = q
+		return nil
+	}
+}
+
+// fixesFor returns the document and the object fixes for software
+func (q *Quirks) fixesFor(software string) ([]QuirkFn, []QuirkFn) {
+	q.m.RLock()
+	defer q.m.RUnlock()
+	// NOTE(marius): the software specific fixes run first, so the generic ones see their results
+	forSoftware := func(fixes map[string][]QuirkFn) []QuirkFn {
+		fns := make([]QuirkFn, 0)
+		if len(software) > 0 {
+			fns = append(fns, fixes[software]...)
+		}
+		return append(fns, fixes[AnySoftware]...)
+	}
+	return forSoftware(q.docFixes), forSoftware(q.fixes)
+}
+
+// apply calls the docFns fixes for the raw JSON document, and the fns fixes for it and its embedded objects
+func apply(raw any, docFns, fns []QuirkFn) {
+	if ob, ok := raw.(map[string]any); ok {
+		for _, fn := range docFns {
+			fn(ob)
+		}
+	}
+	applyQuirks(raw, fns)
+}
+
+// software returns the name of the software the host runs, as detected using NodeInfo
+func (c C) software(ctx context.Context, host string) string {
+	q := c.quirks
+	now := time.Now()
+	q.m.RLock()
+	s, ok := q.hosts[host]
+	q.m.RUnlock()
+	if ok && now.Before(s.expires) {
+		return s.name
+	}
+
+	s = detectedSoftware{expires: now.Add(softwareTTL)}
+	if ni, err := c.NodeInfo(ctx, host); err == nil {
+		s.name = ni.Software.Name
+	} else {
+		c.errFn(Ctx{"host": host})("Unable to detect server software: %s", err)
+		s.expires = now.Add(unknownSoftwareTTL)
+	}
+	q.m.Lock()
+	if q.hosts == nil {
+		q.hosts = make(map[string]detectedSoftware)
+	}
+	q.hosts[host] = s
+	q.m.Unlock()
+	return s.name
+}
+
+// normalize applies the quirk fixes for the software of the server that served the doc document,
+// and returns the rewritten body.
+func (c C) normalize(ctx context.Context, doc document) []byte {
+	u, err := url.Parse(doc.url)
+	if err != nil {
+		return doc.body
+	}
+	docFns, fns := c.quirks.fixesFor(c.software(ctx, u.Host))
+	if len(docFns) == 0 && len(fns) == 0 {
+		return doc.body
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc.body))
+	dec.UseNumber()
+	var raw any
+	if err = dec.Decode(&raw); err != nil {
+		return doc.body
+	}
+	apply(raw, docFns, fns)
+	body, err := json.Marshal(raw)
+	if err != nil {
+		c.errFn(Ctx{"IRI": doc.url})("Unable to encode normalized document: %s", err)
+		return doc.body
+	}
+	return body
+}
+
+// applyQuirks calls the fns fixes for the v JSON object and all the objects embedded in it.
+func applyQuirks(v any, fns []QuirkFn) {
+	switch vv := v.(type) {
+	case map[string]any:
+		for _, fn := range fns {
+			fn(vv)
+		}
+		for _, val := range vv {
+			applyQuirks(val, fns)
+		}
+	case []any:
+		for _, val := range vv {
+			applyQuirks(val, fns)
+		}
+	}
+}
+
+// arrayProperties returns a fix that converts the single values of the props properties into arrays
+func arrayProperties(props ...string) QuirkFn {
+	return func(ob map[string]any) {
+		if _, ok := ob["type"]; !ok {
+			return
+		}
+		for _, p := range props {
+			switch v := ob[p].(type) {
+			case nil, []any:
+			default:
+				ob[p] = []any{v}
+			}
+		}
+	}
+}
+
+// defaultContext sets the ActivityStreams JSON-LD context on documents that are missing one
+func defaultContext(ob map[string]any) {
+	if _, ok := ob["@context"]; !ok {
+		ob["@context"] = vocab.ActivityBaseURI.String()
+	}
+}
+
+// contentFromSource fills the missing content of objects from their plain text, or HTML, source.
+// As the content is HTML, the plain text sources are escaped.
+func contentFromSource(ob map[string]any) {
+	if _, ok := ob["content"]; ok {
+		return
+	}
+	src, ok := ob["source"].(map[string]any)
+	if !ok {
+		return
+	}
+	content, ok := src["content"].(string)
+	if !ok || len(content) == 0 {
+		return
+	}
+	switch mt, _ := src["mediaType"].(string); mt {
+	case "text/html":
+		ob["content"] = content
+	case "", "text/plain":
+		ob["content"] = html.EscapeString(content)
+	}
+}
+
+// misskeyContent converts the MFM source, that Misskey sends as "_misskey_content", into a source
+func misskeyContent(ob map[string]any) {
+	content, ok := ob["_misskey_content"].(string)
+	if !ok {
+		return
+	}
+	delete(ob, "_misskey_content")
+	if _, ok = ob["source"]; ok {
+		return
+	}
+	ob["source"] = map[string]any{"content": content, "mediaType": "text/x.misskeymarkdown"}
+}
+
+// stringSource converts the plain text sources, that Pleroma sends as strings, into objects
+func stringSource(ob map[string]any) {
+	if s, ok := ob["source"].(string); ok {
+		ob["source"] = map[string]any{"content": s, "mediaType": "text/plain"}
+	}
+}
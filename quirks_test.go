@@ -0,0 +1,106 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestWithQuirks(t *testing.T) {
+	var srv *httptest.Server
+	var nodeInfoLoads int32
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/nodeinfo":
+			atomic.AddInt32(&nodeInfoLoads, 1)
+			w.Write([]byte(`{"links": [{"rel": "http://nodeinfo.diaspora.software/ns/schema/2.0", "href": "` + srv.URL + `/nodeinfo/2.0"}]}`))
+		case "/nodeinfo/2.0":
+			w.Write([]byte(`{"version": "2.0", "software": {"name": "Misskey", "version": "2024.1.0"}, "protocols": ["activitypub"]}`))
+		case "/notes/1":
+			w.Write([]byte(`{"id": "` + srv.URL + `/notes/1", "type": "Note", "_misskey_content": "**hello**",
+				"attachment": {"type": "Document", "url": "` + srv.URL + `/files/1.png", "mediaType": "image/png"}}`))
+		case "/notes/2/activity":
+			w.Write([]byte(`{"@context": "https://www.w3.org/ns/activitystreams", "id": "` + srv.URL + `/notes/2/activity", "type": "Create",
+				"object": {"id": "` + srv.URL + `/notes/2", "type": "Note", "source": {"content": "hi there", "mediaType": "text/plain"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	q := DefaultQuirks()
+	q.Register("Misskey", func(ob map[string]any) {
+		if ob["type"] == "Note" {
+			ob["summary"] = "fixed"
+		}
+	})
+	c := New(WithHTTPClient(insecureClient(srv)), WithQuirks(q))
+
+	it, err := c.LoadIRI(vocab.IRI(srv.URL + "/notes/1"))
+	if err != nil {
+		t.Fatalf("LoadIRI() error = %s", err)
+	}
+	ob, err := vocab.ToObject(it)
+	if err != nil {
+		t.Fatalf("LoadIRI() returned %T, expected an object", it)
+	}
+	if ob.Source.Content.First().Value.String() != "**hello**" || ob.Source.MediaType != "text/x.misskeymarkdown" {
+		t.Errorf("Source = %+v, expected the Misskey content", ob.Source)
+	}
+	atts, ok := ob.Attachment.(vocab.ItemCollection)
+	if !ok || len(atts) != 1 || atts[0].GetType() != vocab.DocumentType {
+		t.Errorf("Attachment = %#v, expected a collection with one Document", ob.Attachment)
+	}
+	if ob.Summary.First().Value.String() != "fixed" {
+		t.Errorf("Summary = %v, expected the registered fix to be applied", ob.Summary)
+	}
+
+	it, err = c.LoadIRI(vocab.IRI(srv.URL + "/notes/2/activity"))
+	if err != nil {
+		t.Fatalf("LoadIRI() error = %s", err)
+	}
+	act, err := vocab.ToActivity(it)
+	if err != nil {
+		t.Fatalf("LoadIRI() returned %T, expected an activity", it)
+	}
+	if note, _ := vocab.ToObject(act.Object); note == nil || note.Content.First().Value.String() != "hi there" {
+		t.Errorf("Object = %#v, expected the content to be filled from the source", act.Object)
+	}
+	if n := atomic.LoadInt32(&nodeInfoLoads); n != 1 {
+		t.Errorf("NodeInfo loaded %d times, expected the software of the host to be cached", n)
+	}
+}
+
+func TestDefaultQuirks(t *testing.T) {
+	ob := map[string]any{"type": "Note", "source": "<plain>", "tag": map[string]any{"type": "Hashtag"}}
+	docFns, fns := DefaultQuirks().fixesFor("akkoma")
+	apply(ob, docFns, fns)
+
+	src, ok := ob["source"].(map[string]any)
+	if !ok || src["content"] != "<plain>" || src["mediaType"] != "text/plain" {
+		t.Errorf("source = %#v, expected a plain text source object", ob["source"])
+	}
+	if ob["content"] != "&lt;plain&gt;" {
+		t.Errorf("content = %#v, expected the escaped source content", ob["content"])
+	}
+	tags, ok := ob["tag"].([]any)
+	if !ok || len(tags) != 1 {
+		t.Fatalf("tag = %#v, expected an array", ob["tag"])
+	}
+	if ob["@context"] != vocab.ActivityBaseURI.String() {
+		t.Errorf("@context = %#v, expected the ActivityStreams context", ob["@context"])
+	}
+	if _, ok = tags[0].(map[string]any)["@context"]; ok {
+		t.Errorf("Embedded objects should not get a @context")
+	}
+
+	ob = map[string]any{"type": "Note"}
+	docFns, fns = NewQuirks().fixesFor("akkoma")
+	apply(ob, docFns, fns)
+	if _, ok = ob["@context"]; ok {
+		t.Errorf("@context = %#v, expected an empty registry to not add it", ob["@context"])
+	}
+}
@@ -0,0 +1,221 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxRateLimitBlock caps the time for which a server can ask us to stop sending it requests
+	maxRateLimitBlock = 15 * time.Minute
+	// maxRateLimitWait is the longest we wait for the rate limit of a host before sending a request,
+	// instead we fail it with a RateLimitedError
+	maxRateLimitWait = time.Minute
+)
+
+// RateLimitedError is returned for requests that have not been sent because the rate limit of the remote host
+// would have required waiting for too long
+type RateLimitedError struct {
+	Host    string
+	RetryAt time.Time
+}
+
+func (e RateLimitedError) Error() string {
+	return fmt.Sprintf("host %s is rate limited, retrying after %s", e.Host, e.RetryAt.Format(time.RFC3339))
+}
+
+// RateLimit configures the token bucket used for limiting the requests to a host:
+// Rate is the number of requests per second that are allowed, and Burst is the number of requests
+// that can be made at once. A Rate of 0 means the requests are not limited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// WithRateLimit sets the default rate limit for the requests to every host.
+func WithRateLimit(l RateLimit) OptionFn {
+	return func(c *C) error {
+		if c.limiter == nil {
+			c.limiter = newLimiter()
+		}
+		c.limiter.def = l
+		return nil
+	}
+}
+
+// WithHostRateLimit sets the rate limit for the requests to host, overriding the default one.
+func WithHostRateLimit(host string, l RateLimit) OptionFn {
+	return func(c *C) error {
+		if c.limiter == nil {
+			c.limiter = newLimiter()
+		}
+		c.limiter.hosts[strings.ToLower(host)] = l
+		return nil
+	}
+}
+
+// limiter keeps a token bucket for every host the client sends requests to.
+// Besides the configured rates, it also honours the rate limiting headers sent by the servers,
+// pausing all the requests to a host when it reports that we ran out of requests.
+type limiter struct {
+	m       sync.Mutex
+	def     RateLimit
+	hosts   map[string]RateLimit
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	m            sync.Mutex
+	limit        RateLimit
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+func newLimiter() *limiter {
+	return &limiter{
+		hosts:   make(map[string]RateLimit),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *limiter) bucket(host string) *bucket {
+	host = strings.ToLower(host)
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	if b, ok := l.buckets[host]; ok {
+		return b
+	}
+	lim, ok := l.hosts[host]
+	if !ok {
+		lim = l.def
+	}
+	if lim.Burst < 1 {
+		lim.Burst = 1
+	}
+	b := &bucket{limit: lim, tokens: float64(lim.Burst), last: time.Now()}
+	l.buckets[host] = b
+	return b
+}
+
+// wait blocks until a request to host is allowed, or until the ctx context is done.
+func (l *limiter) wait(ctx context.Context, host string) error {
+	if l == nil {
+		return nil
+	}
+	b := l.bucket(host)
+	for {
+		d := b.reserve(time.Now())
+		if d <= 0 {
+			return nil
+		}
+		if d > maxRateLimitWait {
+			return RateLimitedError{Host: host, RetryAt: time.Now().Add(d)}
+		}
+		if dl, ok := ctx.Deadline(); ok && time.Now().Add(d).After(dl) {
+			// NOTE(marius): there's no point in waiting if the request can't be made before the deadline
+			return errf("rate limit for host %s exceeds the request deadline", host).annotate(context.DeadlineExceeded)
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// reserve takes a token from the bucket and returns 0 if one is available,
+// otherwise it returns the duration until the next token becomes available.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if now.Before(b.blockedUntil) {
+		return b.blockedUntil.Sub(now)
+	}
+	if b.limit.Rate <= 0 {
+		return 0
+	}
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	if max := float64(b.limit.Burst); b.tokens > max {
+		b.tokens = max
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.limit.Rate * float64(time.Second))
+}
+
+// update adjusts the limits for host based on the headers of the resp response.
+func (l *limiter) update(host string, resp *http.Response) {
+	if l == nil || resp == nil {
+		return
+	}
+	now := time.Now()
+	until, ok := limitedUntil(resp, now)
+	if !ok {
+		return
+	}
+	if max := now.Add(maxRateLimitBlock); until.After(max) {
+		// NOTE(marius): the values sent by the server are not to be trusted, so we don't let it block us indefinitely
+		until = max
+	}
+	b := l.bucket(host)
+	b.m.Lock()
+	if until.After(b.blockedUntil) {
+		b.blockedUntil = until
+	}
+	b.m.Unlock()
+}
+
+// limitedUntil returns the time until which the server asked us to stop sending requests,
+// either through a 429 status with a Retry-After header, or through the X-RateLimit-Remaining and
+// X-RateLimit-Reset headers, which are used by Mastodon and other servers.
+func limitedUntil(resp *http.Response, now time.Time) (time.Time, bool) {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if d, ok := retryAfter(resp, now); ok {
+			return now.Add(d), true
+		}
+	}
+	remaining := resp.Header.Get("X-RateLimit-Remaining")
+	if len(remaining) == 0 {
+		return now, false
+	}
+	if rem, err := strconv.ParseFloat(remaining, 64); err != nil || rem >= 1 {
+		return now, false
+	}
+	return parseRateLimitReset(resp.Header.Get("X-RateLimit-Reset"), now)
+}
+
+// parseRateLimitReset parses the value of a X-RateLimit-Reset header, for which servers use
+// different formats: an ISO 8601 timestamp (Mastodon), a Unix timestamp, or a number of seconds.
+func parseRateLimitReset(val string, now time.Time) (time.Time, bool) {
+	if len(val) == 0 {
+		return now, false
+	}
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, true
+	}
+	if sec, err := strconv.ParseFloat(val, 64); err == nil {
+		// NOTE(marius): values that look like a timestamp are considered absolute, the rest relative
+		if sec > 1e9 {
+			sec -= float64(now.UnixNano()) / float64(time.Second)
+		}
+		// NOTE(marius): we cap the value before converting it, so huge values don't overflow the duration
+		if max := maxRateLimitBlock.Seconds(); sec > max {
+			sec = max
+		}
+		return now.Add(time.Duration(sec * float64(time.Second))), true
+	}
+	return now, false
+}
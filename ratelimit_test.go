@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	c := New(WithRateLimit(RateLimit{Rate: 20, Burst: 1}))
+	st := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %s", err)
+		}
+		resp.Body.Close()
+	}
+	if d := time.Since(st); d < 90*time.Millisecond {
+		t.Errorf("3 requests took %s, expected at least 100ms with a rate of 20/s", d)
+	}
+}
+
+func TestWithHostRateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	c := New(WithRateLimit(RateLimit{Rate: 1000, Burst: 10}), WithHostRateLimit(u.Hostname(), RateLimit{Rate: 0.1, Burst: 1}))
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %s", err)
+	}
+	resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = c.CtxGet(ctx, srv.URL); err == nil {
+		t.Errorf("CtxGet() should have failed because the rate limit exceeds the deadline")
+	}
+}
+
+func TestC_Do_rateLimitHeaders(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", time.Now().Add(150*time.Millisecond).UTC().Format(time.RFC3339Nano))
+	}))
+	defer srv.Close()
+
+	c := New(WithRateLimit(RateLimit{}))
+	st := time.Now()
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %s", err)
+		}
+		resp.Body.Close()
+	}
+	if d := time.Since(st); d < 100*time.Millisecond {
+		t.Errorf("2 requests took %s, expected the second one to wait for the rate limit reset", d)
+	}
+}
+
+func Test_parseRateLimitReset(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		val    string
+		want   time.Time
+		wantOk bool
+	}{
+		{val: "", want: now, wantOk: false},
+		{val: "2024-01-01T00:05:00.000000Z", want: now.Add(5 * time.Minute), wantOk: true},
+		{val: "30", want: now.Add(30 * time.Second), wantOk: true},
+		{val: "1704067500", want: now.Add(5 * time.Minute), wantOk: true},
+		{val: "invalid", want: now, wantOk: false},
+		{val: "1e300", want: now.Add(maxRateLimitBlock), wantOk: true},
+		{val: "4102444800", want: now.Add(maxRateLimitBlock), wantOk: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			got, ok := parseRateLimitReset(tt.val, now)
+			if !got.Equal(tt.want) || ok != tt.wantOk {
+				t.Errorf("parseRateLimitReset() = %s, %t, expected %s, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestC_Do_rateLimitCap(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "31536000")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := New(WithRateLimit(RateLimit{}))
+	resp, err := c.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %s", err)
+	}
+	resp.Body.Close()
+
+	st := time.Now()
+	_, err = c.Get(srv.URL)
+	if !IsRateLimited(err) {
+		t.Fatalf("Get() error = %v, expected a rate limited error", err)
+	}
+	if d := time.Since(st); d > time.Second {
+		t.Errorf("Get() took %s, expected it to fail without waiting for the rate limit", d)
+	}
+	e := RateLimitedError{}
+	if errors.As(err, &e) && e.RetryAt.After(st.Add(maxRateLimitBlock)) {
+		t.Errorf("RetryAt = %s, expected the server's value to be capped at %s", e.RetryAt, maxRateLimitBlock)
+	}
+	if requests != 1 {
+		t.Errorf("Server received %d requests, expected the rate limited one to not be sent", requests)
+	}
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-ap/errors"
+)
+
+// RetryPolicy configures how the client retries requests that failed with network errors,
+// or with statuses that signal a transient condition on the remote server: 429, 500, 502, 503 and 504.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts for a request, including the first one.
+	MaxAttempts int
+	// MinBackoff is the delay before the first retry, which is doubled for every subsequent one.
+	MinBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// MaxElapsed caps the total time spent on a request, including all its attempts and delays.
+	// The deadline of the request's context, if earlier, takes precedence.
+	MaxElapsed time.Duration
+	// RetryPOST allows retrying POST requests, which are not idempotent and can lead to duplicate
+	// deliveries when the server processed the request but failed to respond.
+	RetryPOST bool
+}
+
+// DefaultRetryPolicy is a reasonable RetryPolicy for interacting with ActivityPub servers.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	MinBackoff:  500 * time.Millisecond,
+	MaxBackoff:  30 * time.Second,
+	MaxElapsed:  time.Minute,
+}
+
+// WithRetry sets the policy for retrying the failed requests
+func WithRetry(p RetryPolicy) OptionFn {
+	return func(c *C) error {
+		if p.MaxAttempts <= 1 {
+			c.retry = nil
+			return nil
+		}
+		c.retry = &p
+		return nil
+	}
+}
+
+func (p RetryPolicy) allows(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	case http.MethodPost:
+		return p.RetryPOST
+	}
+	return false
+}
+
+// backoff returns the delay before the retry following the attempt, with jitter applied.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// NOTE(marius): we keep half of the delay and randomize the rest, so the clients that failed
+	// at the same time don't all retry at the same time
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+func isRetriable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		// NOTE(marius): the errors caused by the request's own context are final,
+		// but the timeouts of the http.Client are not
+		return ctx.Err() == nil && !IsCircuitOpen(err) && !IsBlockedAddress(err) && !errors.As(err, new(RateLimitedError))
+	}
+	if resp == nil {
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses the Retry-After header of the response, which can be either
+// a number of seconds or an HTTP date.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	val := resp.Header.Get("Retry-After")
+	if len(val) == 0 {
+		return 0, false
+	}
+	if sec, err := strconv.ParseInt(val, 10, 64); err == nil {
+		if sec < 0 {
+			sec = 0
+		}
+		if max := int64(maxRateLimitBlock / time.Second); sec > max {
+			sec = max
+		}
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func (c C) doWithRetry(ctx context.Context, url, method, contentType string, body io.Reader, fns ...reqFn) (*http.Response, error) {
+	p := c.retry
+
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = io.ReadAll(body); err != nil {
+			return nil, err
+		}
+	}
+
+	var deadline time.Time
+	if p.MaxElapsed > 0 {
+		deadline = time.Now().Add(p.MaxElapsed)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+
+	for attempt := 1; ; attempt++ {
+		var b io.Reader
+		if raw != nil {
+			b = bytes.NewReader(raw)
+		}
+		resp, err := c.send(ctx, url, method, contentType, b, fns...)
+		if attempt >= p.MaxAttempts || !isRetriable(ctx, resp, err) {
+			return resp, err
+		}
+
+		now := time.Now()
+		wait := p.backoff(attempt)
+		if ra, ok := retryAfter(resp, now); ok && ra > wait {
+			wait = ra
+		}
+		if !deadline.IsZero() && now.Add(wait).After(deadline) {
+			// NOTE(marius): we can't wait until the next attempt, so we return the last result
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		lCtx := Ctx{"method": method, "iri": url, "attempt": attempt, "wait": wait}
+		if resp != nil {
+			lCtx["status"] = resp.Status
+		}
+		c.log(err)(lCtx)("Retrying request")
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestWithRetry(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+	postPolicy := policy
+	postPolicy.RetryPOST = true
+
+	tests := []struct {
+		name         string
+		policy       RetryPolicy
+		method       string
+		failures     int
+		wantRequests int
+		wantStatus   int
+	}{
+		{
+			name:         "GET recovers",
+			policy:       policy,
+			method:       http.MethodGet,
+			failures:     2,
+			wantRequests: 3,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "GET gives up",
+			policy:       policy,
+			method:       http.MethodGet,
+			failures:     5,
+			wantRequests: 3,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:         "POST is not retried",
+			policy:       policy,
+			method:       http.MethodPost,
+			failures:     1,
+			wantRequests: 1,
+			wantStatus:   http.StatusServiceUnavailable,
+		},
+		{
+			name:         "POST is retried when allowed",
+			policy:       postPolicy,
+			method:       http.MethodPost,
+			failures:     1,
+			wantRequests: 2,
+			wantStatus:   http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.Method == http.MethodPost {
+					if body, _ := io.ReadAll(r.Body); string(body) != "body" {
+						t.Errorf("received body %q on attempt %d", body, requests)
+					}
+				}
+				if requests <= tt.failures {
+					w.Header().Set("Retry-After", "0")
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			c := New(WithRetry(tt.policy))
+			resp, err := c.do(context.Background(), srv.URL, tt.method, "", strings.NewReader("body"))
+			if err != nil {
+				t.Fatalf("do() error = %s", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("do() status = %d, expected %d", resp.StatusCode, tt.wantStatus)
+			}
+			if requests != tt.wantRequests {
+				t.Errorf("server received %d requests, expected %d", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestWithRetry_maxElapsed(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := New(WithRetry(RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxElapsed: time.Second}))
+	_, err := c.LoadIRI(vocab.IRI(srv.URL))
+	if err == nil {
+		t.Errorf("LoadIRI() should have failed")
+	}
+	if requests != 1 {
+		t.Errorf("server received %d requests, expected 1 as Retry-After is over the time limit", requests)
+	}
+}
+
+func Test_retryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		val    string
+		want   time.Duration
+		wantOk bool
+	}{
+		{val: "", want: 0, wantOk: false},
+		{val: "120", want: 2 * time.Minute, wantOk: true},
+		{val: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute, wantOk: true},
+		{val: "invalid", want: 0, wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			resp.Header.Set("Retry-After", tt.val)
+			got, ok := retryAfter(resp, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("retryAfter() = %s, %t, expected %s, %t", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+const (
+	// AlgorithmEd25519 is the RFC 9421 EdDSA algorithm, using the Ed25519 curve
+	AlgorithmEd25519 = "ed25519"
+	// AlgorithmRSAPSS is the RFC 9421 RSASSA-PSS algorithm, using SHA-512
+	AlgorithmRSAPSS = "rsa-pss-sha512"
+	// AlgorithmRSA is the RFC 9421 RSASSA-PKCS1-v1_5 algorithm, using SHA-256
+	AlgorithmRSA = "rsa-v1_5-sha256"
+)
+
+// RFC9421Signer signs requests with HTTP Message Signatures, as described by RFC 9421,
+// adding the Signature-Input, Signature and, for requests with a body, the Content-Digest headers.
+//
+// It can be plugged in the client using its Sign method: New(WithSignFn(signer.Sign))
+type RFC9421Signer struct {
+	// KeyID is the IRI of the public key, usually the "publicKey" of the actor the requests are made as
+	KeyID string
+	// Key is the private key, which can be either a *rsa.PrivateKey, or an ed25519.PrivateKey
+	Key crypto.PrivateKey
+	// Algorithm overrides the signature algorithm, when using an RSA key.
+	// By default, RSA keys use AlgorithmRSAPSS, and Ed25519 keys use AlgorithmEd25519.
+	Algorithm string
+	// Label is the label of the signature, by default "sig1"
+	Label string
+	// Components are the covered components of the signature, in addition to the "content-digest" header,
+	// which is always covered for requests with a body. They can be derived components, like "@method" or
+	// "@authority", or header names. By default, "@method" and "@target-uri" are covered.
+	Components []string
+	// Expires is the validity of the signatures. When zero, signatures don't have an expiration time.
+	Expires time.Duration
+	// Now returns the current time, it's used for the creation time of the signatures.
+	// When nil, time.Now is used.
+	Now func() time.Time
+}
+
+// Sign adds the RFC 9421 signature headers to the req request.
+func (s RFC9421Signer) Sign(req *http.Request) error {
+	if s.Key == nil {
+		return errf("Unable to sign request, nil private key")
+	}
+	if len(s.KeyID) == 0 {
+		return errf("Unable to sign request, empty key id")
+	}
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	label := s.Label
+	if len(label) == 0 {
+		label = "sig1"
+	}
+	components := s.Components
+	if len(components) == 0 {
+		components = []string{"@method", "@target-uri"}
+	}
+	components = append(components[:len(components):len(components)], "content-digest")
+
+	if digest, err := contentDigest(req); err != nil {
+		return err
+	} else if len(digest) > 0 {
+		req.Header.Set("Content-Digest", digest)
+	} else {
+		components = components[:len(components)-1]
+	}
+
+	alg, err := rfc9421Algorithm(s.Key, s.Algorithm)
+	if err != nil {
+		return err
+	}
+	created := now().UTC()
+	params := sigParams(components, created, s.Expires, s.KeyID, alg)
+	base, err := signatureBase(req, components, params)
+	if err != nil {
+		return err
+	}
+	sig, err := rfc9421Sign(s.Key, alg, []byte(base))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Signature-Input", label+"="+params)
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+func sigParams(components []string, created time.Time, expires time.Duration, keyID, alg string) string {
+	s := strings.Builder{}
+	s.WriteString("(")
+	for i, c := range components {
+		if i > 0 {
+			s.WriteString(" ")
+		}
+		s.WriteString(strconv.Quote(strings.ToLower(c)))
+	}
+	s.WriteString(")")
+	s.WriteString(";created=" + strconv.FormatInt(created.Unix(), 10))
+	if expires > 0 {
+		s.WriteString(";expires=" + strconv.FormatInt(created.Add(expires).Unix(), 10))
+	}
+	s.WriteString(";keyid=" + strconv.Quote(keyID))
+	s.WriteString(";alg=" + strconv.Quote(alg))
+	return s.String()
+}
+
+// signatureBase builds the signature base of RFC 9421 for the req request, from its covered components
+// and the serialized signature parameters.
+func signatureBase(req *http.Request, components []string, params string) (string, error) {
+	lines := make([]string, 0, len(components)+1)
+	for _, c := range components {
+		c = strings.ToLower(c)
+		var val string
+		switch c {
+		case "@method":
+			val = strings.ToUpper(req.Method)
+		case "@target-uri":
+			u := *req.URL
+			if len(u.Host) == 0 {
+				u.Host = requestHost(req)
+			}
+			if len(u.Scheme) == 0 {
+				u.Scheme = requestScheme(req)
+			}
+			if len(u.Path) == 0 && len(u.Opaque) == 0 {
+				u.Path = "/"
+			}
+			val = u.String()
+		case "@authority":
+			val = strings.ToLower(requestHost(req))
+		case "@scheme":
+			val = requestScheme(req)
+		case "@path":
+			val = req.URL.EscapedPath()
+			if len(val) == 0 {
+				val = "/"
+			}
+		case "@query":
+			val = "?" + req.URL.RawQuery
+		case "@request-target":
+			val = req.URL.RequestURI()
+		default:
+			if strings.HasPrefix(c, "@") {
+				return "", errf("Unsupported derived component %s", c)
+			}
+			vals := make([]string, 0)
+			for _, v := range req.Header.Values(c) {
+				vals = append(vals, strings.TrimSpace(v))
+			}
+			if c == "host" && len(vals) == 0 {
+				vals = append(vals, requestHost(req))
+			}
+			if len(vals) == 0 {
+				return "", errf("Unable to sign request, missing covered header %s", c)
+			}
+			val = strings.Join(vals, ", ")
+		}
+		lines = append(lines, strconv.Quote(c)+": "+val)
+	}
+	lines = append(lines, `"@signature-params": `+params)
+	return strings.Join(lines, "\n"), nil
+}
+
+// requestScheme returns the scheme of the req request, which for the requests received by a server
+// needs to be inferred from the TLS connection state, or from the headers set by a reverse proxy.
+func requestScheme(req *http.Request) string {
+	if len(req.URL.Scheme) > 0 {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if proto := req.Header.Get("X-Forwarded-Proto"); len(proto) > 0 {
+		return strings.ToLower(proto)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// contentDigest returns the value of the Content-Digest header, as described by RFC 9530,
+// for the body of the req request, or an empty string if the request doesn't have a body.
+func contentDigest(req *http.Request) (string, error) {
+	digest, err := bodyDigest(req)
+	if err != nil || len(digest) == 0 {
+		return "", err
+	}
+	// NOTE(marius): bodyDigest returns the legacy "SHA-256=base64" format, which uses the same hash
+	return "sha-256=:" + strings.TrimPrefix(digest, "SHA-256=") + ":", nil
+}
+
+func rfc9421Algorithm(key crypto.PrivateKey, alg string) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		switch alg {
+		case "":
+			return AlgorithmRSAPSS, nil
+		case AlgorithmRSAPSS, AlgorithmRSA:
+			return alg, nil
+		}
+	case ed25519.PrivateKey, *ed25519.PrivateKey:
+		if alg == "" || alg == AlgorithmEd25519 {
+			return AlgorithmEd25519, nil
+		}
+	default:
+		return "", errf("Unsupported private key type %T", key)
+	}
+	return "", errf("Unsupported algorithm %s for private key type %T", alg, key)
+}
+
+func rfc9421Sign(key crypto.PrivateKey, alg string, data []byte) ([]byte, error) {
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		if alg == AlgorithmRSA {
+			sum := sha256.Sum256(data)
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+			break
+		}
+		sum := sha512.Sum512(data)
+		sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA512, sum[:], &rsa.PSSOptions{SaltLength: 64})
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, data)
+	case *ed25519.PrivateKey:
+		sig = ed25519.Sign(*k, data)
+	}
+	if err != nil {
+		return nil, errf("Unable to sign request").annotate(err)
+	}
+	return sig, nil
+}
+
+// WithDoubleKnock enables retrying the deliveries rejected by the remote server, as not authorized,
+// using the fallback signing function. It's meant to be used together with an RFC9421Signer for the client,
+// and a CavageSigner as fallback, for servers that don't support RFC 9421 signatures yet.
+//
+// The hosts for which the fallback succeeded are remembered, and the next deliveries to them use it directly.
+func WithDoubleKnock(fallback RequestSignFn) OptionFn {
+	return func(c *C) error {
+		if fallback == nil {
+			c.knock = nil
+			return nil
+		}
+		c.knock = &doubleKnock{fallback: fallback, legacy: make(map[string]struct{})}
+		return nil
+	}
+}
+
+type doubleKnock struct {
+	fallback RequestSignFn
+	m        sync.RWMutex
+	legacy   map[string]struct{}
+}
+
+func (k *doubleKnock) isLegacy(host string) bool {
+	k.m.RLock()
+	defer k.m.RUnlock()
+	_, ok := k.legacy[strings.ToLower(host)]
+	return ok
+}
+
+func (k *doubleKnock) remember(host string) {
+	k.m.Lock()
+	defer k.m.Unlock()
+	k.legacy[strings.ToLower(host)] = struct{}{}
+}
+
+func signatureRejected(resp *http.Response) bool {
+	return resp != nil && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden)
+}
+
+// deliver posts the body to the url collection, retrying with the fallback signing function
+// when double knocking is enabled and the remote server rejected the request.
+func (c C) deliver(ctx context.Context, url vocab.IRI, body []byte) (*http.Response, error) {
+	post := func(c C) (*http.Response, error) {
+		return c.do(ctx, url.String(), http.MethodPost, ContentTypeActivityJson, bytes.NewReader(body))
+	}
+	if c.knock == nil {
+		return post(c)
+	}
+	host := ""
+	if u, err := url.URL(); err == nil {
+		host = u.Hostname()
+	}
+	legacy := c
+	legacy.signFn = c.knock.fallback
+	if c.knock.isLegacy(host) {
+		return post(legacy)
+	}
+
+	resp, err := post(c)
+	if err != nil || !signatureRejected(resp) {
+		return resp, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	c.infoFn(Ctx{"iri": url, "status": resp.Status})("Delivery rejected, retrying with the fallback signature")
+	if resp, err = post(legacy); err == nil && resp.StatusCode < http.StatusBadRequest {
+		c.knock.remember(host)
+	}
+	return resp, err
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestRFC9421Signer_Sign(t *testing.T) {
+	s := RFC9421Signer{KeyID: "https://example.com/actor#main-key", Key: testEd25519Key, Now: testNow, Expires: 5 * time.Minute}
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/inbox?page=1", bytes.NewReader([]byte(`{"type":"Follow"}`)))
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Sign() error = %s", err)
+	}
+
+	if d := req.Header.Get("Content-Digest"); d != "sha-256=:GYwYnH3BiO6aICFt0ThC5bUIJ4byvqdpWtR8m5fNkww=:" {
+		t.Errorf("Content-Digest = %s", d)
+	}
+	params := `("@method" "@target-uri" "content-digest");created=1704164645;expires=1704164945;keyid="https://example.com/actor#main-key";alg="ed25519"`
+	if got := req.Header.Get("Signature-Input"); got != "sig1="+params {
+		t.Errorf("Signature-Input = %s, expected sig1=%s", got, params)
+	}
+	base := `"@method": POST
+"@target-uri": https://example.com/inbox?page=1
+"content-digest": sha-256=:GYwYnH3BiO6aICFt0ThC5bUIJ4byvqdpWtR8m5fNkww=:
+"@signature-params": ` + params
+	if got, _ := signatureBase(req, []string{"@method", "@target-uri", "content-digest"}, params); got != base {
+		t.Errorf("signatureBase() = %q, expected %q", got, base)
+	}
+	sigHeader := req.Header.Get("Signature")
+	if !strings.HasPrefix(sigHeader, "sig1=:") || !strings.HasSuffix(sigHeader, ":") {
+		t.Fatalf("Invalid Signature header %s", sigHeader)
+	}
+	sig, _ := base64.StdEncoding.DecodeString(strings.TrimSuffix(strings.TrimPrefix(sigHeader, "sig1=:"), ":"))
+	if !ed25519.Verify(testEd25519Key.Public().(ed25519.PublicKey), []byte(base), sig) {
+		t.Errorf("Signature doesn't verify")
+	}
+}
+
+func TestRFC9421Signer_Sign_rsaPSS(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	s := RFC9421Signer{KeyID: "https://example.com/actor#main-key", Key: key, Now: testNow, Components: []string{"@method", "@authority", "@path", "date"}}
+	req, _ := http.NewRequest(http.MethodGet, "https://Example.com/actor", nil)
+	req.Header.Set("Date", "Tue, 02 Jan 2024 03:04:05 GMT")
+	if err := s.Sign(req); err != nil {
+		t.Fatalf("Sign() error = %s", err)
+	}
+	params := `("@method" "@authority" "@path" "date");created=1704164645;keyid="https://example.com/actor#main-key";alg="rsa-pss-sha512"`
+	if got := req.Header.Get("Signature-Input"); got != "sig1="+params {
+		t.Errorf("Signature-Input = %s, expected sig1=%s", got, params)
+	}
+	base, _ := signatureBase(req, []string{"@method", "@authority", "@path", "date"}, params)
+	if !strings.Contains(base, `"@authority": example.com`) || !strings.Contains(base, `"@path": /actor`) {
+		t.Errorf("signatureBase() = %q", base)
+	}
+	sig, _ := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimPrefix(req.Header.Get("Signature"), "sig1="), ":"))
+	sum := sha512.Sum512([]byte(base))
+	if err := rsa.VerifyPSS(&key.PublicKey, crypto.SHA512, sum[:], sig, nil); err != nil {
+		t.Errorf("Signature doesn't verify: %s", err)
+	}
+	if err := (RFC9421Signer{KeyID: "id", Key: key, Components: []string{"x-missing"}}).Sign(req); err == nil {
+		t.Errorf("Sign() should have failed for a missing covered header")
+	}
+}
+
+func TestWithDoubleKnock(t *testing.T) {
+	var requests, legacy int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Signature-Input") != "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		legacy++
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	c := New(
+		WithSignFn(RFC9421Signer{KeyID: "https://example.com/actor#main-key", Key: testEd25519Key}.Sign),
+		WithDoubleKnock(CavageSigner{KeyID: "https://example.com/actor#main-key", Key: testEd25519Key}.Sign),
+	)
+	for i := 0; i < 2; i++ {
+		if _, _, err := c.ToCollection(vocab.IRI(srv.URL+"/inbox"), &vocab.Activity{Type: vocab.FollowType}); err != nil {
+			t.Fatalf("ToCollection() error = %s", err)
+		}
+	}
+	if requests != 3 || legacy != 2 {
+		t.Errorf("Sent %d requests, %d with the legacy signature, expected 3 and 2", requests, legacy)
+	}
+}
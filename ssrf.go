@@ -0,0 +1,181 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+
+	"github.com/go-ap/errors"
+	"golang.org/x/oauth2"
+)
+
+// blockedPrefixes are the address ranges refused by the dialer installed by WithPrivateNetworkBlocking
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),          // "this" network
+	netip.MustParsePrefix("10.0.0.0/8"),         // RFC1918
+	netip.MustParsePrefix("100.64.0.0/10"),      // CGNAT shared address space
+	netip.MustParsePrefix("100.100.100.200/32"), // Alibaba Cloud metadata
+	netip.MustParsePrefix("127.0.0.0/8"),        // loopback
+	netip.MustParsePrefix("169.254.0.0/16"),     // link-local, including the 169.254.169.254 metadata address
+	netip.MustParsePrefix("172.16.0.0/12"),      // RFC1918
+	netip.MustParsePrefix("192.168.0.0/16"),     // RFC1918
+	netip.MustParsePrefix("::/128"),             // unspecified
+	netip.MustParsePrefix("::1/128"),            // loopback
+	netip.MustParsePrefix("64:ff9b::/96"),       // NAT64, which can embed any of the IPv4 addresses above
+	netip.MustParsePrefix("fc00::/7"),           // ULA, including the fd00:ec2::254 metadata address
+	netip.MustParsePrefix("fe80::/10"),          // link-local
+}
+
+// BlockedAddressError is returned for requests refused because they resolve to a private network address
+type BlockedAddressError struct {
+	Addr netip.Addr
+}
+
+func (e BlockedAddressError) Error() string {
+	return fmt.Sprintf("connections to %s are not allowed", e.Addr)
+}
+
+// IsBlockedAddress returns true if the err error was caused by a request to a private network address,
+// or by a request refused because the private network blocking could not be enabled.
+func IsBlockedAddress(err error) bool {
+	return errors.As(err, new(BlockedAddressError)) || errors.As(err, new(blockingError))
+}
+
+// blockingError is returned for all the requests of a client for which WithPrivateNetworkBlocking failed
+type blockingError struct {
+	err error
+}
+
+func (e blockingError) Error() string {
+	return fmt.Sprintf("request refused, private network blocking could not be enabled: %s", e.err)
+}
+
+func (e blockingError) Unwrap() error {
+	return e.err
+}
+
+// refusingTransport is the transport installed by WithPrivateNetworkBlocking when it fails,
+// so the client doesn't make unprotected requests
+type refusingTransport struct {
+	err error
+}
+
+func (t refusingTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, blockingError{err: t.err}
+}
+
+// WithPrivateNetworkBlocking installs a dialer that refuses connections to loopback, link-local,
+// private (RFC1918 and ULA) and cloud metadata addresses.
+// The addresses are checked after the DNS resolution, right before connecting, so hosts that resolve,
+// or re-resolve, to a private address are refused too.
+//
+// The allow parameter contains addresses or prefixes, like "127.0.0.1" or "192.168.1.0/24",
+// which are exempted from the check, and is meant for development environments.
+//
+// The option fails when the transport of the http client is neither an *http.Transport, nor an *oauth2.Transport
+// wrapping one, as it can't install the dialer in other transports without dropping them, or when one of
+// the allowed addresses is invalid. In that case the client refuses all requests.
+//
+// NOTE(marius): when the client is using a proxy, only the address of the proxy is checked.
+func WithPrivateNetworkBlocking(allow ...string) OptionFn {
+	return func(c *C) error {
+		// NOTE(marius): we don't modify the http.Client or the http.Transport in place, as they can be shared
+		// with other clients, eg: the defaultClient and defaultTransport
+		hc := *c.c
+		c.c = &hc
+		// NOTE(marius): New ignores the errors of the options, so when we fail, we make sure that
+		// the client can't make requests without the protection it asked for
+		refuse := func(err error) error {
+			hc.Transport = refusingTransport{err: err}
+			c.errFn()("Unable to enable private network blocking: %s", err)
+			return err
+		}
+
+		allowed := make([]netip.Prefix, 0, len(allow))
+		for _, a := range allow {
+			p, err := parsePrefix(a)
+			if err != nil {
+				return refuse(errf("Invalid allowed address %s", a).annotate(err))
+			}
+			allowed = append(allowed, p)
+		}
+		d := newDialer()
+		d.Control = blockPrivateNetworks(allowed)
+
+		tr, err := withDialer(hc.Transport, d)
+		if err != nil {
+			return refuse(err)
+		}
+		hc.Transport = tr
+		return nil
+	}
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	a, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	a = a.Unmap()
+	return netip.PrefixFrom(a, a.BitLen()), nil
+}
+
+// withDialer returns a copy of the rt transport which uses the d dialer.
+// It fails for the transports it doesn't know how to copy, instead of replacing them.
+func withDialer(rt http.RoundTripper, d *net.Dialer) (http.RoundTripper, error) {
+	switch tr := rt.(type) {
+	case nil:
+		return withDialer(defaultTransport, d)
+	case *http.Transport:
+		tr = tr.Clone()
+		tr.DialContext = d.DialContext
+		return tr, nil
+	case *oauth2.Transport:
+		base, err := withDialer(tr.Base, d)
+		if err != nil {
+			return nil, err
+		}
+		return &oauth2.Transport{Source: tr.Source, Base: base}, nil
+	}
+	return nil, errf("Unable to install the private network blocking dialer in transport of type %T", rt)
+}
+
+// blockPrivateNetworks returns a net.Dialer Control function that refuses connections to private addresses,
+// except the ones in the allowed prefixes
+func blockPrivateNetworks(allowed []netip.Prefix) func(string, string, syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return errf("Unable to parse dialed address %s", address).annotate(err)
+		}
+		addr := ap.Addr().Unmap().WithZone("")
+		for _, p := range allowed {
+			if p.Contains(addr) {
+				return nil
+			}
+		}
+		if isBlockedAddr(addr) {
+			return BlockedAddressError{Addr: addr}
+		}
+		return nil
+	}
+}
+
+func isBlockedAddr(addr netip.Addr) bool {
+	if addr.IsMulticast() || addr.IsUnspecified() {
+		return true
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
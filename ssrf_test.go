@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestWithPrivateNetworkBlocking(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"type": "Note"}`))
+	}))
+	defer srv.Close()
+
+	c := New(WithRetry(DefaultRetryPolicy), WithPrivateNetworkBlocking())
+	if _, err := c.CtxLoadIRI(context.Background(), vocab.IRI(srv.URL)); !IsBlockedAddress(err) {
+		t.Errorf("CtxLoadIRI() error = %v, expected a blocked address error", err)
+	}
+	if c.c == defaultClient {
+		t.Errorf("WithPrivateNetworkBlocking() should not modify the default client")
+	}
+
+	c = New(WithPrivateNetworkBlocking("127.0.0.0/8", "::1"))
+	if _, err := c.CtxLoadIRI(context.Background(), vocab.IRI(srv.URL)); err != nil {
+		t.Errorf("CtxLoadIRI() error = %v, expected the allowed address to be reachable", err)
+	}
+
+	rt := roundTripperFunc(http.DefaultTransport.RoundTrip)
+	wrapped := &http.Client{Transport: rt}
+	failed := map[string]*C{
+		"unknown transport":       New(WithHTTPClient(wrapped), WithPrivateNetworkBlocking()),
+		"invalid allowed address": New(WithPrivateNetworkBlocking("not-an-ip")),
+	}
+	for name, c := range failed {
+		t.Run(name, func(t *testing.T) {
+			if _, err := c.CtxLoadIRI(context.Background(), vocab.IRI(srv.URL)); !IsBlockedAddress(err) {
+				t.Errorf("CtxLoadIRI() error = %v, expected the client to refuse all requests", err)
+			}
+		})
+	}
+	if _, ok := wrapped.Transport.(roundTripperFunc); !ok {
+		t.Errorf("WithPrivateNetworkBlocking() should not modify the transport of the http client")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func Test_isBlockedAddr(t *testing.T) {
+	tests := map[string]bool{
+		"127.0.0.1":       true,
+		"10.1.2.3":        true,
+		"172.20.0.1":      true,
+		"192.168.1.1":     true,
+		"169.254.169.254": true,
+		"0.0.0.0":         true,
+		"::1":             true,
+		"fd00:ec2::254":   true,
+		"fe80::1":         true,
+		"100.64.0.1":      true,
+		"64:ff9b::a00:1":  true,
+		"93.184.216.34":   false,
+		"172.32.0.1":      false,
+		"2606:4700::1111": false,
+	}
+	for addr, want := range tests {
+		t.Run(addr, func(t *testing.T) {
+			if got := isBlockedAddr(netip.MustParseAddr(addr)); got != want {
+				t.Errorf("isBlockedAddr() = %t, expected %t", got, want)
+			}
+		})
+	}
+}
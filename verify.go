@@ -0,0 +1,452 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ap/errors"
+	vocab "github.com/mix/activitypub"
+)
+
+// DefaultMaxClockSkew is the default maximum difference between the time a request was signed and the time
+// we received it.
+const DefaultMaxClockSkew = time.Hour
+
+// SignatureVerifier verifies the HTTP signatures of the requests we receive, both in the draft-cavage
+// format and in the RFC 9421 one.
+//
+// It can be used as a middleware: http.Handle("/inbox", verifier.Handler(inboxHandler))
+type SignatureVerifier struct {
+	// Client is used for loading the public keys of the signers
+	Client *C
+	// Keys resolves and caches the public keys of the signers.
+	// When nil, the keys are loaded using the Client for every request.
+	Keys *KeyResolver
+	// MaxSkew is the maximum difference between the time a request was signed and the current time.
+	// When zero, DefaultMaxClockSkew is used.
+	MaxSkew time.Duration
+	// Now returns the current time, when nil, time.Now is used.
+	Now func() time.Time
+}
+
+type ctxKey int
+
+const actorCtxKey ctxKey = iota
+
+// ActorFromContext returns the actor that signed the request, as attached to its context by SignatureVerifier.Handler
+func ActorFromContext(ctx context.Context) (*vocab.Actor, bool) {
+	act, ok := ctx.Value(actorCtxKey).(*vocab.Actor)
+	return act, ok && act != nil
+}
+
+// Handler returns a middleware that verifies the signatures of the requests, before passing them to the next
+// handler, with the signing actor attached to their context. The requests that fail the verification are
+// handled by the package ErrorHandler.
+func (v SignatureVerifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		act, err := v.Verify(r)
+		if err != nil {
+			ErrorHandler(err).ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorCtxKey, act)))
+	})
+}
+
+// signature holds the parts of a parsed signature, independent of its format
+type signature struct {
+	keyID     vocab.IRI
+	alg       string
+	base      []byte
+	sig       []byte
+	covered   []string
+	created   time.Time
+	expires   time.Time
+	digestHdr string
+}
+
+// Verify checks the signature of the r request and returns the actor that signed it.
+func (v SignatureVerifier) Verify(r *http.Request) (*vocab.Actor, error) {
+	if v.Client == nil {
+		return nil, errors.Newf("Unable to verify signature, nil client")
+	}
+	body, err := readBody(r)
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "Unable to read request body")
+	}
+
+	var sig *signature
+	switch {
+	case len(r.Header.Get("Signature-Input")) > 0:
+		sig, err = parseRFC9421Signature(r)
+	case len(r.Header.Get("Signature")) > 0:
+		sig, err = parseCavageSignature(r, r.Header.Get("Signature"))
+	case strings.HasPrefix(r.Header.Get("Authorization"), "Signature "):
+		sig, err = parseCavageSignature(r, strings.TrimPrefix(r.Header.Get("Authorization"), "Signature "))
+	default:
+		return nil, errors.Unauthorizedf("Missing request signature")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = v.checkTime(r, sig); err != nil {
+		return nil, err
+	}
+	if err = checkDigest(r, sig, body); err != nil {
+		return nil, err
+	}
+
+	keys := v.Keys
+	if keys == nil {
+		keys = &KeyResolver{c: v.Client, ttl: -1}
+	}
+	key, err := keys.Resolve(r.Context(), sig.keyID)
+	if err != nil {
+		return nil, errors.NewUnauthorized(err, "Unable to load public key %s", sig.keyID)
+	}
+	if err = verifyWithKey(key.Key, sig.alg, sig.base, sig.sig); err != nil && key.cached {
+		// NOTE(marius): the key might have been rotated since we cached it, so we load it again
+		if key, err = keys.resolve(r.Context(), sig.keyID, true); err != nil {
+			return nil, errors.NewUnauthorized(err, "Unable to load public key %s", sig.keyID)
+		}
+		err = verifyWithKey(key.Key, sig.alg, sig.base, sig.sig)
+	}
+	if err != nil {
+		return nil, errors.NewUnauthorized(err, "Invalid signature for key %s", sig.keyID)
+	}
+	if key.actor != nil {
+		return key.actor, nil
+	}
+	act, err := v.Client.Actor(r.Context(), key.Owner)
+	if err != nil {
+		return nil, errors.NewUnauthorized(err, "Unable to load the owner of key %s", sig.keyID)
+	}
+	return act, nil
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+func (v SignatureVerifier) checkTime(r *http.Request, sig *signature) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	skew := v.MaxSkew
+	if skew <= 0 {
+		skew = DefaultMaxClockSkew
+	}
+	inWindow := func(t time.Time) bool {
+		return t.After(now.Add(-skew)) && t.Before(now.Add(skew))
+	}
+
+	if !sig.expires.IsZero() && now.After(sig.expires) {
+		return errors.Unauthorizedf("Signature has expired at %s", sig.expires.Format(time.RFC3339))
+	}
+	if !sig.created.IsZero() {
+		if !inWindow(sig.created) {
+			return errors.Unauthorizedf("Signature creation time %s is too far from the current time", sig.created.Format(time.RFC3339))
+		}
+		return nil
+	}
+	if !contains(sig.covered, "date") {
+		return errors.Unauthorizedf("Signature must cover the date")
+	}
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return errors.NewBadRequest(err, "Invalid Date header")
+	}
+	if !inWindow(date) {
+		return errors.Unauthorizedf("Date %s is too far from the current time", r.Header.Get("Date"))
+	}
+	return nil
+}
+
+// checkDigest verifies that requests with a body have a signed digest header, which matches their body.
+func checkDigest(r *http.Request, sig *signature, body []byte) error {
+	if len(body) == 0 {
+		return nil
+	}
+	if !contains(sig.covered, sig.digestHdr) {
+		return errors.Unauthorizedf("Signature must cover the %s header", sig.digestHdr)
+	}
+	val := r.Header.Get(sig.digestHdr)
+	for _, d := range splitTopLevel(val, ',') {
+		alg, enc, ok := strings.Cut(strings.TrimSpace(d), "=")
+		if !ok {
+			continue
+		}
+		enc = strings.Trim(enc, ":")
+		var sum []byte
+		switch strings.ToLower(alg) {
+		case "sha-256":
+			s := sha256.Sum256(body)
+			sum = s[:]
+		case "sha-512":
+			s := sha512.Sum512(body)
+			sum = s[:]
+		default:
+			continue
+		}
+		if exp, err := base64.StdEncoding.DecodeString(enc); err != nil || subtle.ConstantTimeCompare(exp, sum) != 1 {
+			return errors.BadRequestf("%s doesn't match the request body", sig.digestHdr)
+		}
+		return nil
+	}
+	return errors.BadRequestf("Missing or unsupported %s header", sig.digestHdr)
+}
+
+func parseCavageSignature(r *http.Request, val string) (*signature, error) {
+	params := make(map[string]string)
+	for _, p := range splitTopLevel(val, ',') {
+		k, v, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok {
+			continue
+		}
+		if uv, err := strconv.Unquote(v); err == nil {
+			v = uv
+		}
+		params[k] = v
+	}
+	if len(params["keyId"]) == 0 || len(params["signature"]) == 0 {
+		return nil, errors.BadRequestf("Invalid signature, missing keyId or signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, errors.NewBadRequest(err, "Invalid signature encoding")
+	}
+	sig := signature{keyID: vocab.IRI(params["keyId"]), alg: params["algorithm"], sig: raw, digestHdr: "digest"}
+	sig.covered = strings.Fields(strings.ToLower(params["headers"]))
+	if len(sig.covered) == 0 {
+		sig.covered = []string{"date"}
+	}
+	// NOTE(marius): signatures that don't cover the target can be replayed to any other endpoint
+	if !contains(sig.covered, "(request-target)") {
+		return nil, errors.Unauthorizedf("Signature must cover the (request-target)")
+	}
+	// NOTE(marius): the created and expires parameters are trusted only when they are signed,
+	// otherwise anyone could refresh a captured signature by appending them to it
+	if contains(sig.covered, "(created)") {
+		if sig.created, err = unixParam(params["created"]); err != nil {
+			return nil, err
+		}
+	}
+	if contains(sig.covered, "(expires)") {
+		if sig.expires, err = unixParam(params["expires"]); err != nil {
+			return nil, err
+		}
+	}
+	lines := make([]string, 0, len(sig.covered))
+	for _, h := range sig.covered {
+		switch h {
+		case "(created)":
+			lines = append(lines, h+": "+params["created"])
+		case "(expires)":
+			lines = append(lines, h+": "+params["expires"])
+		default:
+			if !strings.HasPrefix(h, "(") && len(r.Header.Values(h)) == 0 && h != "host" {
+				return nil, errors.BadRequestf("Missing signed header %s", h)
+			}
+			lines = append(lines, cavageSigningString(r, []string{h}))
+		}
+	}
+	sig.base = []byte(strings.Join(lines, "\n"))
+	return &sig, nil
+}
+
+func parseRFC9421Signature(r *http.Request) (*signature, error) {
+	inputs := dictionary(r.Header.Get("Signature-Input"))
+	sigs := dictionary(r.Header.Get("Signature"))
+
+	for _, label := range dictionaryKeys(r.Header.Get("Signature-Input")) {
+		sigVal, ok := sigs[label]
+		if !ok {
+			continue
+		}
+		input := inputs[label]
+		end := strings.IndexByte(input, ')')
+		if !strings.HasPrefix(input, "(") || end < 0 {
+			return nil, errors.BadRequestf("Invalid Signature-Input %s", label)
+		}
+		sig := signature{digestHdr: "content-digest"}
+		for _, c := range strings.Fields(input[1:end]) {
+			name, err := strconv.Unquote(c)
+			if err != nil {
+				return nil, errors.BadRequestf("Unsupported covered component %s", c)
+			}
+			sig.covered = append(sig.covered, name)
+		}
+		if !contains(sig.covered, "@method") || !(contains(sig.covered, "@target-uri") || contains(sig.covered, "@path")) {
+			return nil, errors.Unauthorizedf("Signature must cover the @method and the @target-uri, or the @path")
+		}
+		for _, p := range splitTopLevel(input[end+1:], ';') {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			var err error
+			switch k {
+			case "keyid":
+				v, err = strconv.Unquote(v)
+				sig.keyID = vocab.IRI(v)
+			case "alg":
+				sig.alg, err = strconv.Unquote(v)
+			case "created":
+				sig.created, err = unixParam(v)
+			case "expires":
+				sig.expires, err = unixParam(v)
+			}
+			if err != nil {
+				return nil, errors.NewBadRequest(err, "Invalid signature parameter %s", k)
+			}
+		}
+		if len(sig.keyID) == 0 {
+			return nil, errors.BadRequestf("Invalid signature, missing keyid")
+		}
+		raw, err := base64.StdEncoding.DecodeString(strings.Trim(sigVal, ":"))
+		if err != nil {
+			return nil, errors.NewBadRequest(err, "Invalid signature encoding")
+		}
+		sig.sig = raw
+		base, err := signatureBase(r, sig.covered, input)
+		if err != nil {
+			return nil, errors.NewBadRequest(err, "Unable to build signature base")
+		}
+		sig.base = []byte(base)
+		return &sig, nil
+	}
+	return nil, errors.BadRequestf("Invalid signature, no matching Signature and Signature-Input")
+}
+
+func unixParam(v string) (time.Time, error) {
+	if len(v) == 0 {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.NewBadRequest(err, "Invalid timestamp %s", v)
+	}
+	return time.Unix(sec, 0), nil
+}
+
+// dictionary parses a structured field dictionary, like the Signature and Signature-Input headers,
+// keeping the raw serialization of its values.
+func dictionary(val string) map[string]string {
+	res := make(map[string]string)
+	for _, m := range splitTopLevel(val, ',') {
+		if k, v, ok := strings.Cut(strings.TrimSpace(m), "="); ok {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func dictionaryKeys(val string) []string {
+	keys := make([]string, 0)
+	for _, m := range splitTopLevel(val, ',') {
+		if k, _, ok := strings.Cut(strings.TrimSpace(m), "="); ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// splitTopLevel splits s by sep, ignoring the separators inside quoted strings, parentheses and byte sequences
+func splitTopLevel(s string, sep byte) []string {
+	res := make([]string, 0)
+	quoted, bytesSeq, depth, st := false, false, 0, 0
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case quoted:
+			if ch == '\\' {
+				i++
+			} else if ch == '"' {
+				quoted = false
+			}
+		case ch == '"':
+			quoted = true
+		case ch == ':' && sep != ':':
+			bytesSeq = !bytesSeq
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+		case ch == sep && depth == 0 && !bytesSeq:
+			res = append(res, s[st:i])
+			st = i + 1
+		}
+	}
+	if st < len(s) {
+		res = append(res, s[st:])
+	}
+	return res
+}
+
+func contains(s []string, v string) bool {
+	for _, vv := range s {
+		if strings.EqualFold(vv, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePublicKeyPem(s string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, errors.Newf("invalid PEM encoded public key")
+	}
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		return pub, nil
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+// verifyWithKey verifies the sig signature of data, with the pub public key
+func verifyWithKey(pub crypto.PublicKey, alg string, data, sig []byte) error {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if alg != "" && alg != "hs2019" && alg != AlgorithmEd25519 && alg != "ed25519-sha512" {
+			return errors.Newf("algorithm %s doesn't match the key type", alg)
+		}
+		if !ed25519.Verify(k, data, sig) {
+			return errors.Newf("ed25519 verification failed")
+		}
+		return nil
+	case *rsa.PublicKey:
+		switch alg {
+		case AlgorithmRSAPSS:
+			sum := sha512.Sum512(data)
+			return rsa.VerifyPSS(k, crypto.SHA512, sum[:], sig, nil)
+		case "", "hs2019", "rsa-sha256", AlgorithmRSA:
+			sum := sha256.Sum256(data)
+			err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig)
+			if err != nil && alg == "hs2019" {
+				// NOTE(marius): hs2019 lets the key decide the algorithm, which for RSA keys can be PSS too
+				sum := sha512.Sum512(data)
+				err = rsa.VerifyPSS(k, crypto.SHA512, sum[:], sig, nil)
+			}
+			return err
+		}
+		return errors.Newf("algorithm %s doesn't match the key type", alg)
+	}
+	return errors.Newf("unsupported public key type %T", pub)
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func testActorServer() *httptest.Server {
+	der, _ := x509.MarshalPKIXPublicKey(testEd25519Key.Public())
+	pemKey := strings.ReplaceAll(string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), "\n", `\n`)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"id": "` + srv.URL + `/actor", "type": "Person", "inbox": "` + srv.URL + `/inbox",
+			"publicKey": {"id": "` + srv.URL + `/actor#main-key", "owner": "` + srv.URL + `/actor", "publicKeyPem": "` + pemKey + `"}}`))
+	}))
+	return srv
+}
+
+func TestSignatureVerifier_Handler(t *testing.T) {
+	actors := testActorServer()
+	defer actors.Close()
+	keyID := actors.URL + "/actor#main-key"
+
+	var signer *vocab.Actor
+	inbox := httptest.NewServer(SignatureVerifier{Client: New()}.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signer, _ = ActorFromContext(r.Context())
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	defer inbox.Close()
+
+	tests := map[string]RequestSignFn{
+		"cavage":  CavageSigner{KeyID: keyID, Key: testEd25519Key}.Sign,
+		"rfc9421": RFC9421Signer{KeyID: keyID, Key: testEd25519Key, Expires: time.Minute}.Sign,
+	}
+	for name, fn := range tests {
+		t.Run(name, func(t *testing.T) {
+			signer = nil
+			c := New(WithSignFn(fn))
+			if _, _, err := c.ToCollection(vocab.IRI(inbox.URL), &vocab.Activity{Type: vocab.FollowType}); err != nil {
+				t.Fatalf("ToCollection() error = %s", err)
+			}
+			if signer == nil || signer.ID != vocab.IRI(actors.URL+"/actor") {
+				t.Errorf("ActorFromContext() = %v, expected the signing actor", signer)
+			}
+		})
+	}
+
+	invalid := map[string]func(*http.Request){
+		"unsigned": func(r *http.Request) {},
+		"tampered body": func(r *http.Request) {
+			CavageSigner{KeyID: keyID, Key: testEd25519Key}.Sign(r)
+			r.Body, r.ContentLength = io.NopCloser(strings.NewReader(`{"type":"Block"}`)), 16
+		},
+		"expired date": func(r *http.Request) {
+			CavageSigner{KeyID: keyID, Key: testEd25519Key, Now: func() time.Time { return time.Now().Add(-2 * time.Hour) }}.Sign(r)
+		},
+		"replayed with unsigned created": func(r *http.Request) {
+			CavageSigner{KeyID: keyID, Key: testEd25519Key, Now: func() time.Time { return time.Now().Add(-48 * time.Hour) }}.Sign(r)
+			r.Header.Set("Signature", r.Header.Get("Signature")+",created="+strconv.FormatInt(time.Now().Unix(), 10))
+		},
+		"cavage without request target": func(r *http.Request) {
+			sum := sha256.Sum256([]byte(`{"type":"Follow"}`))
+			r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+			r.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum[:]))
+			base := "date: " + r.Header.Get("Date") + "\ndigest: " + r.Header.Get("Digest")
+			sig := base64.StdEncoding.EncodeToString(ed25519.Sign(testEd25519Key, []byte(base)))
+			r.Header.Set("Signature", `keyId="`+keyID+`",algorithm="hs2019",headers="date digest",signature="`+sig+`"`)
+		},
+		"rfc9421 without method and target": func(r *http.Request) {
+			RFC9421Signer{KeyID: keyID, Key: testEd25519Key, Components: []string{"@authority"}}.Sign(r)
+		},
+		"unknown key": func(r *http.Request) {
+			RFC9421Signer{KeyID: actors.URL + "/actor#other-key", Key: testEd25519Key}.Sign(r)
+		},
+	}
+	for name, fn := range invalid {
+		t.Run(name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, inbox.URL, bytes.NewReader([]byte(`{"type":"Follow"}`)))
+			fn(req)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %s", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusUnauthorized && resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("Response status = %s, expected the request to be rejected", resp.Status)
+			}
+		})
+	}
+}
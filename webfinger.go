@@ -0,0 +1,324 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	vocab "github.com/mix/activitypub"
+)
+
+// ContentTypeJRD is the media type of the WebFinger JSON Resource Descriptors
+//
+// https://www.rfc-editor.org/rfc/rfc7033#section-10.2
+const ContentTypeJRD = "application/jrd+json"
+
+// JRD is a JSON Resource Descriptor, as returned by WebFinger
+type JRD struct {
+	Subject    string             `json:"subject,omitempty"`
+	Aliases    []string           `json:"aliases,omitempty"`
+	Properties map[string]*string `json:"properties,omitempty"`
+	Links      []JRDLink          `json:"links,omitempty"`
+}
+
+// JRDLink is a link of a JSON Resource Descriptor
+type JRDLink struct {
+	Rel        string             `json:"rel"`
+	Type       string             `json:"type,omitempty"`
+	Href       string             `json:"href,omitempty"`
+	Template   string             `json:"template,omitempty"`
+	Titles     map[string]string  `json:"titles,omitempty"`
+	Properties map[string]*string `json:"properties,omitempty"`
+}
+
+// Link returns the first link with the rel relation, and, if typ is not empty, with the typ media type
+func (j JRD) Link(rel, typ string) *JRDLink {
+	for i, l := range j.Links {
+		if l.Rel == rel && (len(typ) == 0 || l.Type == typ) {
+			return &j.Links[i]
+		}
+	}
+	return nil
+}
+
+// ActorIRI returns the IRI of the ActivityPub actor described by the JRD, from its "self" link
+func (j JRD) ActorIRI() (vocab.IRI, bool) {
+	for _, l := range j.Links {
+		if l.Rel == "self" && len(l.Href) > 0 && isActivityStreamsType(l.Type) {
+			return vocab.IRI(l.Href), true
+		}
+	}
+	return "", false
+}
+
+func isActivityStreamsType(typ string) bool {
+	typ = strings.TrimSpace(typ)
+	return typ == ContentTypeActivityJson ||
+		strings.HasPrefix(typ, "application/ld+json") && strings.Contains(typ, "https://www.w3.org/ns/activitystreams")
+}
+
+// acctResource normalizes the handle, which can be in any of the "acct:alice@example.com", "@alice@example.com"
+// or "alice@example.com" formats, or an http(s) IRI, into a WebFinger resource, and returns the host to query.
+func acctResource(handle string) (string, string, error) {
+	handle = strings.TrimSpace(handle)
+	if strings.HasPrefix(handle, "https://") || strings.HasPrefix(handle, "http://") {
+		u, err := url.Parse(handle)
+		if err != nil || len(u.Host) == 0 {
+			return "", "", errf("Invalid WebFinger resource %s", handle)
+		}
+		return handle, u.Host, nil
+	}
+	acct := strings.TrimPrefix(strings.TrimPrefix(handle, "acct:"), "@")
+	i := strings.LastIndexByte(acct, '@')
+	if i <= 0 || i == len(acct)-1 {
+		return "", "", errf("Invalid WebFinger handle %s", handle)
+	}
+	return "acct:" + acct, strings.ToLower(acct[i+1:]), nil
+}
+
+// WebFinger queries the WebFinger end-point of the host that the resource belongs to.
+// The resource can be an "acct:alice@example.com" URI, a "@alice@example.com" handle, or an http(s) IRI.
+// If the host doesn't have a WebFinger end-point, the LRDD template from its host-meta document is used.
+func (c C) WebFinger(ctx context.Context, resource string) (*JRD, error) {
+	res, host, err := acctResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	wf := "https://" + host + "/.well-known/webfinger?resource=" + url.QueryEscape(res)
+	jrd, err := c.jrd(ctx, wf)
+	if err == nil {
+		return jrd, nil
+	}
+	if StatusCode(err) == 0 {
+		return nil, err
+	}
+
+	// NOTE(marius): the server doesn't have a WebFinger end-point at the default location,
+	// so we look for one in its host-meta document
+	tpl, herr := c.lrddTemplate(ctx, host)
+	if herr != nil {
+		c.errFn(Ctx{"host": host})("Unable to load host-meta: %s", herr)
+		return nil, err
+	}
+	return c.jrd(ctx, strings.ReplaceAll(tpl, "{uri}", url.QueryEscape(res)))
+}
+
+// ActorByHandle resolves the handle, like "@alice@example.com", using WebFinger, and loads the actor it belongs to.
+//
+// When the actor is hosted on a different domain than the handle, the domain of the actor is queried
+// for the canonical handle of the actor, which must be the same as the requested one.
+func (c C) ActorByHandle(ctx context.Context, handle string) (*vocab.Actor, error) {
+	jrd, err := c.WebFinger(ctx, handle)
+	if err != nil {
+		return nil, err
+	}
+	iri, ok := jrd.ActorIRI()
+	if !ok {
+		return nil, errf("WebFinger response for %s doesn't contain an ActivityPub actor", handle)
+	}
+
+	res, host, _ := acctResource(handle)
+	u, err := iri.URL()
+	if err != nil {
+		return nil, errf("Invalid actor IRI for %s", handle).iri(iri).annotate(err)
+	}
+	act, err := c.Actor(ctx, iri)
+	if err != nil || strings.EqualFold(u.Host, host) {
+		return act, err
+	}
+	if err = c.confirmHandle(ctx, act, res, jrd); err != nil {
+		return nil, errf("Unable to confirm the actor for %s", handle).iri(iri).annotate(err)
+	}
+	return act, nil
+}
+
+// confirmHandle checks that the canonical handle of the act actor, as resolved on the domain of the actor,
+// is the res WebFinger resource we started from.
+func (c C) confirmHandle(ctx context.Context, act *vocab.Actor, res string, jrd *JRD) error {
+	if !strings.HasPrefix(res, "acct:") {
+		// NOTE(marius): the lookup was done by IRI, so we use the account the server claimed for it
+		res = jrd.Subject
+	}
+	if !strings.HasPrefix(res, "acct:") {
+		return errf("Unable to determine the account for %s", res)
+	}
+	canonical, err := c.Handle(ctx, act)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(canonical, strings.TrimPrefix(res, "acct:")) {
+		return errf("Actor's canonical handle %s doesn't match %s", canonical, res)
+	}
+	return nil
+}
+
+func acceptJRD(r *http.Request) {
+	r.Header.Set("Accept", ContentTypeJRD+", application/json")
+}
+
+func (c C) jrd(ctx context.Context, u string) (*JRD, error) {
+	body, err := c.wellKnown(ctx, u, acceptJRD)
+	if err != nil {
+		return nil, err
+	}
+	jrd := new(JRD)
+	if err = json.Unmarshal(body, jrd); err != nil {
+		return nil, errf("Unable to parse WebFinger response %s", u).annotate(err)
+	}
+	return jrd, nil
+}
+
+// xrd is the XML Resource Descriptor format of host-meta documents
+type xrd struct {
+	Links []struct {
+		Rel      string `xml:"rel,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Link"`
+}
+
+// lrddTemplate loads the host-meta document of host, and returns its LRDD link template
+func (c C) lrddTemplate(ctx context.Context, host string) (string, error) {
+	body, err := c.wellKnown(ctx, "https://"+host+"/.well-known/host-meta", func(r *http.Request) {
+		r.Header.Set("Accept", "application/xrd+xml, "+ContentTypeJRD)
+	})
+	if err != nil {
+		return "", err
+	}
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '{' {
+		jrd := new(JRD)
+		if err = json.Unmarshal(b, jrd); err == nil {
+			if l := jrd.Link("lrdd", ""); l != nil && len(l.Template) > 0 {
+				return l.Template, nil
+			}
+		}
+	} else {
+		doc := xrd{}
+		if err = xml.Unmarshal(body, &doc); err == nil {
+			for _, l := range doc.Links {
+				if l.Rel == "lrdd" && len(l.Template) > 0 {
+					return l.Template, nil
+				}
+			}
+		}
+	}
+	if err != nil {
+		return "", errf("Unable to parse host-meta for %s", host).annotate(err)
+	}
+	return "", errf("Missing LRDD template in host-meta for %s", host)
+}
+
+// wellKnown loads the body of the u well known URL, with the fns modifiers applied to the request
+func (c C) wellKnown(ctx context.Context, u string, fns ...reqFn) ([]byte, error) {
+	resp, err := c.do(ctx, u, http.MethodGet, "", nil, fns...)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errf("Unable to load %s", u).annotate(newHTTPError(resp, vocab.IRI(u)))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWellKnownLen))
+	if err != nil {
+		return nil, errf("Unable to read %s", u).annotate(err)
+	}
+	return body, nil
+}
+
+// maxWellKnownLen is the maximum size of the well known documents we load, like WebFinger responses
+const maxWellKnownLen = 1 << 20
+
+// handleTTL is the duration for which the canonical handles of the actors are cached
+const handleTTL = 24 * time.Hour
+
+// maxCachedHandles is the number of handles after which the cache starts evicting the expired ones
+const maxCachedHandles = 10000
+
+type cachedHandle struct {
+	handle  string
+	expires time.Time
+}
+
+// handles caches the canonical handles of the actors, resolved with reverse WebFinger lookups
+type handles struct {
+	m sync.RWMutex
+	h map[vocab.IRI]cachedHandle
+}
+
+func (h *handles) load(iri vocab.IRI, now time.Time) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	h.m.RLock()
+	defer h.m.RUnlock()
+	ch, ok := h.h[iri]
+	if !ok || now.After(ch.expires) {
+		return "", false
+	}
+	return ch.handle, true
+}
+
+func (h *handles) store(iri vocab.IRI, handle string, now time.Time) {
+	if h == nil {
+		return
+	}
+	h.m.Lock()
+	defer h.m.Unlock()
+	if h.h == nil {
+		h.h = make(map[vocab.IRI]cachedHandle)
+	}
+	if len(h.h) >= maxCachedHandles {
+		for i, ch := range h.h {
+			if now.After(ch.expires) {
+				delete(h.h, i)
+			}
+		}
+	}
+	if len(h.h) >= maxCachedHandles {
+		for i := range h.h {
+			delete(h.h, i)
+			break
+		}
+	}
+	h.h[iri] = cachedHandle{handle: handle, expires: now.Add(handleTTL)}
+}
+
+// handle resolves the canonical handle of the act actor, verifying that the WebFinger "self" link
+// of the handle points back to the actor
+func (c C) handle(ctx context.Context, act *vocab.Actor) (string, error) {
+	name := act.PreferredUsername.First().Value.String()
+	if len(name) == 0 {
+		return "", errf("Actor doesn't have a preferredUsername").iri(act.ID)
+	}
+	u, err := act.ID.URL()
+	if err != nil || len(u.Host) == 0 {
+		return "", errf("Invalid actor IRI").iri(act.ID)
+	}
+
+	acct := "acct:" + name + "@" + u.Host
+	for i := 0; i < 2; i++ {
+		jrd, err := c.WebFinger(ctx, acct)
+		if err != nil {
+			return "", errf("Unable to resolve handle %s", acct).iri(act.ID).annotate(err)
+		}
+		if self, ok := jrd.ActorIRI(); !ok || self != act.ID {
+			return "", errf("WebFinger for %s doesn't point back to the actor", acct).iri(act.ID)
+		}
+		if len(jrd.Subject) == 0 || strings.EqualFold(jrd.Subject, acct) {
+			return strings.TrimPrefix(acct, "acct:"), nil
+		}
+		// NOTE(marius): the canonical handle is on a different domain than the one we queried,
+		// like for servers with a separate web domain, so we verify it too
+		if !strings.HasPrefix(jrd.Subject, "acct:") {
+			return "", errf("Invalid WebFinger subject %s", jrd.Subject).iri(act.ID)
+		}
+		acct = jrd.Subject
+	}
+	return "", errf("Too many WebFinger redirections for %s", acct).iri(act.ID)
+}
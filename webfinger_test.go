@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vocab "github.com/mix/activitypub"
+)
+
+func TestC_ActorByHandle(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.Replace(strings.TrimPrefix(srv.URL, "https://"), "127.0.0.1", "localhost", 1)
+		switch r.URL.Path {
+		case "/.well-known/webfinger":
+			res := r.URL.Query().Get("resource")
+			if strings.HasPrefix(r.Host, "localhost") && res == "acct:bob@"+r.Host {
+				// NOTE(marius): bob uses the host-meta fallback
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fallthrough
+		case "/lrdd":
+			res := r.URL.Query().Get("resource")
+			user := strings.TrimPrefix(res[:strings.IndexByte(res, '@')], "acct:")
+			self := user
+			if user == "admin" {
+				// NOTE(marius): an account that claims to be the actor of another user
+				self = "alice"
+			}
+			w.Header().Set("Content-Type", ContentTypeJRD)
+			w.Write([]byte(`{"subject": "acct:` + user + `@` + host + `", "links": [
+				{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": "` + srv.URL + `/@` + user + `"},
+				{"rel": "self", "type": "application/activity+json", "href": "` + srv.URL + `/users/` + self + `"}]}`))
+		case "/.well-known/host-meta":
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<XRD xmlns="http://docs.oasis-open.org/ns/xri/xrd-1.0"><Link rel="lrdd" template="https://` + r.Host + `/lrdd?resource={uri}"/></XRD>`))
+		case "/users/alice", "/users/bob":
+			w.Write([]byte(`{"id": "` + srv.URL + r.URL.Path + `", "type": "Person", "preferredUsername": "` + strings.TrimPrefix(r.URL.Path, "/users/") + `"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tr := srv.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	c := New(WithHTTPClient(&http.Client{Transport: tr}))
+	host := strings.TrimPrefix(srv.URL, "https://")
+	ctx := context.Background()
+
+	jrd, err := c.WebFinger(ctx, "acct:alice@"+host)
+	if err != nil {
+		t.Fatalf("WebFinger() error = %s", err)
+	}
+	if iri, ok := jrd.ActorIRI(); !ok || iri.String() != srv.URL+"/users/alice" {
+		t.Errorf("ActorIRI() = %s, %t", iri, ok)
+	}
+
+	handles := map[string]string{
+		"@alice@" + host: "/users/alice",
+		"alice@" + strings.Replace(host, "127.0.0.1", "localhost", 1): "/users/alice",
+		"@bob@" + strings.Replace(host, "127.0.0.1", "localhost", 1):  "/users/bob",
+	}
+	for handle, path := range handles {
+		t.Run(handle, func(t *testing.T) {
+			act, err := c.ActorByHandle(ctx, handle)
+			if err != nil {
+				t.Fatalf("ActorByHandle() error = %s", err)
+			}
+			if act.ID.String() != srv.URL+path {
+				t.Errorf("ActorByHandle() = %s, expected %s", act.ID, srv.URL+path)
+			}
+		})
+	}
+
+	if _, err = c.ActorByHandle(ctx, "@admin@"+strings.Replace(host, "127.0.0.1", "localhost", 1)); err == nil {
+		t.Errorf("ActorByHandle() should have failed for a handle that is not the actor's canonical one")
+	}
+	if _, err = c.ActorByHandle(ctx, "@carol"); err == nil {
+		t.Errorf("ActorByHandle() should have failed for an invalid handle")
+	}
+}
+
+func TestC_Handle(t *testing.T) {
+	requests := 0
+	var srv *httptest.Server
+	srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		webHost := strings.TrimPrefix(srv.URL, "https://")
+		accountHost := strings.Replace(webHost, "127.0.0.1", "localhost", 1)
+		res := r.URL.Query().Get("resource")
+		switch res {
+		case "acct:alice@" + webHost, "acct:alice@" + accountHost:
+			w.Write([]byte(`{"subject": "acct:alice@` + accountHost + `", "links": [{"rel": "self", "type": "application/activity+json", "href": "` + srv.URL + `/users/alice"}]}`))
+		case "acct:mallory@" + webHost:
+			w.Write([]byte(`{"subject": "acct:mallory@` + webHost + `", "links": [{"rel": "self", "type": "application/activity+json", "href": "` + srv.URL + `/users/alice"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	tr := srv.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	c := New(WithHTTPClient(&http.Client{Transport: tr}))
+	ctx := context.Background()
+
+	alice := &vocab.Actor{ID: vocab.IRI(srv.URL + "/users/alice"), Type: vocab.PersonType, PreferredUsername: vocab.DefaultNaturalLanguageValue("alice")}
+	want := "alice@" + strings.Replace(strings.TrimPrefix(srv.URL, "https://"), "127.0.0.1", "localhost", 1)
+	for i := 0; i < 2; i++ {
+		if h, err := c.Handle(ctx, alice); err != nil || h != want {
+			t.Errorf("Handle() = %s, %v, expected %s", h, err, want)
+		}
+	}
+	if requests != 2 {
+		t.Errorf("Sent %d requests, expected the handle to be cached after the first two", requests)
+	}
+
+	mallory := &vocab.Actor{ID: vocab.IRI(srv.URL + "/users/mallory"), Type: vocab.PersonType, PreferredUsername: vocab.DefaultNaturalLanguageValue("mallory")}
+	if h, err := c.Handle(ctx, mallory); err == nil {
+		t.Errorf("Handle() = %s, expected an error for a handle pointing to a different actor", h)
+	}
+}